@@ -0,0 +1,231 @@
+package germanium
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"golang.org/x/image/math/fixed"
+)
+
+// AnimationTyping is the animation of the source code typed character by
+// character
+const AnimationTyping = "typing"
+
+const (
+	// minFrameDelay is the shortest delay of a frame, which is the unit of
+	// the delays of GIF
+	minFrameDelay = 10 * time.Millisecond
+	// blinkInterval is how long the cursor is shown or hidden while the
+	// whole source code is held
+	blinkInterval = 500 * time.Millisecond
+)
+
+// Animation renders the source code into an animated GIF, or an APNG for
+// FormatPNG
+type Animation struct {
+	// Mode is the kind of the animation, AnimationTyping
+	Mode string
+	// CharsPerFrame is the number of the characters typed in a frame
+	CharsPerFrame int
+	// Delay is the duration of a frame
+	Delay time.Duration
+	// Hold is how long the whole source code is shown at the end
+	Hold time.Duration
+	// Cursor draws the cursor after the typed characters, which blinks while
+	// the whole source code is held
+	Cursor bool
+}
+
+func (a Animation) validate() error {
+	if a.Mode != AnimationTyping {
+		return fmt.Errorf("unsupported animation: %s", a.Mode)
+	}
+	if a.CharsPerFrame < 1 {
+		return fmt.Errorf("invalid number of characters per frame: %d", a.CharsPerFrame)
+	}
+	if a.Delay < minFrameDelay {
+		return fmt.Errorf("frame delay must be at least %v: %v", minFrameDelay, a.Delay)
+	}
+	if a.Hold < 0 {
+		return fmt.Errorf("invalid hold duration: %v", a.Hold)
+	}
+	return nil
+}
+
+// frame is the region of the animation which differs from the previous
+// frame, shown for the delay
+type frame struct {
+	img   *image.RGBA
+	delay time.Duration
+}
+
+// Animate labels the source code on the panel like Label, and writes the
+// animation of it being typed into out. The canvas is laid out for the whole
+// source code, and each frame keeps only the region changed from the
+// previous one.
+func (p *Panel) Animate(out io.Writer, src io.Reader, filename, language string, a Animation) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if p.format != FormatGIF && p.format != FormatPNG {
+		return fmt.Errorf("animation is not supported in %s format", p.format)
+	}
+
+	style, tokens, err := p.label(src, filename, language)
+	if err != nil {
+		return err
+	}
+	f := p.Formatter.(*PNGFormatter)
+	f.lineCount = len(chroma.SplitTokensIntoLines(tokens))
+
+	// the window and the title are drawn once under every frame
+	base := image.NewRGBA(p.img.Rect)
+	copy(base.Pix, p.img.Pix)
+
+	prev, cur := image.NewRGBA(p.img.Rect), image.NewRGBA(p.img.Rect)
+	render := func(n int, cursor bool) {
+		copy(cur.Pix, base.Pix)
+		f.drawer.Dst = cur
+		dot := f.draw(style, typedTokens(tokens, n))
+		if cursor {
+			f.drawCursor(style, dot)
+		}
+	}
+
+	var frames []frame
+	push := func(delay time.Duration) {
+		r := cur.Rect
+		if len(frames) > 0 {
+			r = changedRect(prev, cur)
+		}
+		if r.Empty() {
+			frames[len(frames)-1].delay += delay
+			return
+		}
+
+		img := image.NewRGBA(r)
+		draw.Draw(img, r, cur, r.Min, draw.Src)
+		frames = append(frames, frame{img: img, delay: delay})
+		prev, cur = cur, prev
+	}
+
+	total := 0
+	for _, t := range tokens {
+		total += utf8.RuneCountInString(t.Value)
+	}
+	for n := 0; n < total; n += a.CharsPerFrame {
+		render(n, a.Cursor)
+		push(a.Delay)
+	}
+
+	hold := a.Hold
+	if hold < a.Delay {
+		hold = a.Delay
+	}
+	on := true
+	for t := time.Duration(0); t < hold; t += blinkInterval {
+		d := hold - t
+		if d > blinkInterval {
+			d = blinkInterval
+		}
+		render(total, a.Cursor && on)
+		push(d)
+		on = !on
+	}
+
+	// the panel holds the last frame, which prev is after pushing it
+	p.img = prev
+	f.drawer.Dst = prev
+
+	if p.format == FormatGIF {
+		return encodeGIF(out, frames, prev)
+	}
+	dpi := 0.0
+	if p.scale != 1 {
+		dpi = baseDPI * p.scale
+	}
+	return encodeAPNG(out, frames, dpi)
+}
+
+// typedTokens returns the tokens of the first n characters
+func typedTokens(tokens []chroma.Token, n int) []chroma.Token {
+	var typed []chroma.Token
+	for _, t := range tokens {
+		if n <= 0 {
+			break
+		}
+		if c := utf8.RuneCountInString(t.Value); c > n {
+			t.Value = string([]rune(t.Value)[:n])
+		}
+		typed = append(typed, t)
+		n -= utf8.RuneCountInString(t.Value)
+	}
+	return typed
+}
+
+// drawCursor draws the bar cursor at the dot on the baseline
+func (f *PNGFormatter) drawCursor(style *chroma.Style, dot fixed.Point26_6) {
+	m := f.drawer.Face.Metrics()
+	width := int(f.fontSize / 12)
+	if width < 1 {
+		width = 1
+	}
+	x, y := dot.X.Round(), dot.Y.Round()
+	bar := image.Rect(x, y-m.Ascent.Round(), x+width, y+m.Descent.Round())
+	fg := chooseColorBasedOnContrast(windowBackground(style))
+	draw.Draw(f.drawer.Dst, bar, image.NewUniform(fg), image.Point{}, draw.Over)
+}
+
+// changedRect returns the smallest rectangle containing the pixels which
+// differ between the images of the same bounds
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	n := a.Rect.Dx() * 4
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		i := a.PixOffset(a.Rect.Min.X, y)
+		ra, rb := a.Pix[i:i+n], b.Pix[i:i+n]
+		if bytes.Equal(ra, rb) {
+			continue
+		}
+
+		start, end := 0, n
+		for ra[start] == rb[start] {
+			start++
+		}
+		for ra[end-1] == rb[end-1] {
+			end--
+		}
+		r = r.Union(image.Rect(a.Rect.Min.X+start/4, y, a.Rect.Min.X+(end+3)/4, y+1))
+	}
+	return r
+}
+
+// encodeGIF encodes the frames into the animated GIF looping forever, whose
+// palette is chosen from the last frame
+func encodeGIF(w io.Writer, frames []frame, last image.Image) error {
+	palette := medianCut{}.Quantize(make(color.Palette, 0, 256), last)
+
+	g := &gif.GIF{
+		Config: image.Config{
+			ColorModel: palette,
+			Width:      last.Bounds().Dx(),
+			Height:     last.Bounds().Dy(),
+		},
+	}
+	for _, f := range frames {
+		img := image.NewPaletted(f.img.Rect, palette)
+		draw.Draw(img, img.Rect, f.img, f.img.Rect.Min, draw.Src)
+		g.Image = append(g.Image, img)
+		g.Delay = append(g.Delay, int((f.delay+5*time.Millisecond)/minFrameDelay))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	return gif.EncodeAll(w, g)
+}
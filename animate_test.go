@@ -0,0 +1,183 @@
+package germanium
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAnimation = Animation{
+	Mode:          AnimationTyping,
+	CharsPerFrame: 3,
+	Delay:         40 * time.Millisecond,
+	Hold:          time.Second,
+}
+
+// decodeAPNG composites the frames of the APNG, and returns the last frame
+// and the number of the frames
+func decodeAPNG(t *testing.T, b []byte) (*image.NRGBA, int) {
+	t.Helper()
+
+	if !bytes.HasPrefix(b, []byte(pngSignature)) {
+		t.Fatal("no PNG signature")
+	}
+	b = b[len(pngSignature):]
+
+	var ihdr []byte
+	var canvas *image.NRGBA
+	var frames, seq uint32
+	var rect image.Rectangle
+	var data []byte
+
+	flush := func() {
+		if data == nil {
+			return
+		}
+		// a frame is decoded as the PNG of its size
+		header := append([]byte(nil), ihdr...)
+		binary.BigEndian.PutUint32(header[0:], uint32(rect.Dx()))
+		binary.BigEndian.PutUint32(header[4:], uint32(rect.Dy()))
+		var frame bytes.Buffer
+		frame.WriteString(pngSignature)
+		frame.Write(pngChunk("IHDR", header))
+		frame.Write(pngChunk("IDAT", data))
+		frame.Write(pngChunk("IEND", nil))
+		img, err := png.Decode(&frame)
+		if err != nil {
+			t.Fatalf("frame %d: %v", frames, err)
+		}
+		draw.Draw(canvas, rect, img, image.Point{}, draw.Src)
+		frames++
+		data = nil
+	}
+
+	for len(b) > 0 {
+		n := binary.BigEndian.Uint32(b)
+		typ, body := string(b[4:8]), b[8:8+n]
+		if crc := binary.BigEndian.Uint32(b[8+n:]); crc != crc32.ChecksumIEEE(b[4:8+n]) {
+			t.Fatalf("CRC mismatch of %s", typ)
+		}
+		b = b[12+n:]
+
+		switch typ {
+		case "IHDR":
+			ihdr = body
+			canvas = image.NewNRGBA(image.Rect(0, 0, int(binary.BigEndian.Uint32(body)), int(binary.BigEndian.Uint32(body[4:]))))
+		case "fcTL", "fdAT":
+			if s := binary.BigEndian.Uint32(body); s != seq {
+				t.Fatalf("sequence number = %d, want %d", s, seq)
+			}
+			seq++
+			if typ == "fdAT" {
+				data = append(data, body[4:]...)
+				continue
+			}
+			flush()
+			x, y := int(binary.BigEndian.Uint32(body[12:])), int(binary.BigEndian.Uint32(body[16:]))
+			rect = image.Rect(x, y, x+int(binary.BigEndian.Uint32(body[4:])), y+int(binary.BigEndian.Uint32(body[8:])))
+		case "IDAT":
+			data = append(data, body...)
+		}
+	}
+	flush()
+	return canvas, int(frames)
+}
+
+func TestAnimateAPNG(t *testing.T) {
+	want, err := NewRenderer(WithLanguage("go")).RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := Render(context.Background(), &out, strings.NewReader(testSource), WithLanguage("go"), WithAnimation(testAnimation)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the static decoder shows the first frame of the empty window
+	first, err := png.Decode(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Bounds() != want.Bounds() {
+		t.Errorf("bounds = %v, want %v", first.Bounds(), want.Bounds())
+	}
+
+	last, frames := decodeAPNG(t, out.Bytes())
+	if n := (len(testSource) + 2) / 3; frames != n+1 {
+		t.Errorf("frames = %d, want %d", frames, n+1)
+	}
+	wantNRGBA := image.NewNRGBA(want.Bounds())
+	draw.Draw(wantNRGBA, want.Bounds(), want, image.Point{}, draw.Src)
+	if !reflect.DeepEqual(last.Pix, wantNRGBA.Pix) {
+		t.Errorf("last frame differs from the image")
+	}
+}
+
+func TestAnimateGIF(t *testing.T) {
+	a := testAnimation
+	a.Cursor = true
+
+	var out bytes.Buffer
+	if err := Render(context.Background(), &out, strings.NewReader(testSource), WithLanguage("go"), WithFormat(FormatGIF), WithAnimation(a)); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the typed frames, and the blinking cursor while the last one is held
+	if n := (len(testSource)+2)/3 + 2; len(g.Image) != n {
+		t.Errorf("frames = %d, want %d", len(g.Image), n)
+	}
+	canvas := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if g.Image[0].Rect != canvas {
+		t.Errorf("first frame = %v, want %v", g.Image[0].Rect, canvas)
+	}
+	for i, img := range g.Image[1:] {
+		if img.Rect.Dx()*img.Rect.Dy() >= canvas.Dx()*canvas.Dy()/4 {
+			t.Errorf("frame %d is not cropped to the changes: %v", i+1, img.Rect)
+		}
+	}
+	if d := g.Delay[len(g.Delay)-1]; d != 50 {
+		t.Errorf("delay of the last frame = %d, want 50", d)
+	}
+}
+
+func TestAnimateInvalid(t *testing.T) {
+	tests := []struct {
+		desc   string
+		format string
+		modify func(*Animation)
+	}{
+		{desc: "format", format: FormatJPEG},
+		{desc: "mode", modify: func(a *Animation) { a.Mode = "fade" }},
+		{desc: "chars", modify: func(a *Animation) { a.CharsPerFrame = 0 }},
+		{desc: "delay", modify: func(a *Animation) { a.Delay = time.Millisecond }},
+	}
+
+	for _, tt := range tests {
+		a := testAnimation
+		if tt.modify != nil {
+			tt.modify(&a)
+		}
+		format := FormatPNG
+		if tt.format != "" {
+			format = tt.format
+		}
+		err := Render(context.Background(), &bytes.Buffer{}, strings.NewReader(testSource), WithLanguage("go"), WithFormat(format), WithAnimation(a))
+		if err == nil {
+			t.Errorf("%s: invalid animation is rendered", tt.desc)
+		}
+	}
+}
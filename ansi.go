@@ -0,0 +1,529 @@
+package germanium
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// ANSIPaletteStyle is the terminal palette derived from the colors of the
+// Chroma style
+const ANSIPaletteStyle = "style"
+
+// ansiPalettes are the named palettes of the 16 terminal colors
+var ansiPalettes = map[string][16]color.RGBA{
+	"xterm": {
+		{0, 0, 0, 255}, {205, 0, 0, 255}, {0, 205, 0, 255}, {205, 205, 0, 255},
+		{0, 0, 238, 255}, {205, 0, 205, 255}, {0, 205, 205, 255}, {229, 229, 229, 255},
+		{127, 127, 127, 255}, {255, 0, 0, 255}, {0, 255, 0, 255}, {255, 255, 0, 255},
+		{92, 92, 255, 255}, {255, 0, 255, 255}, {0, 255, 255, 255}, {255, 255, 255, 255},
+	},
+	"vga": {
+		{0, 0, 0, 255}, {170, 0, 0, 255}, {0, 170, 0, 255}, {170, 85, 0, 255},
+		{0, 0, 170, 255}, {170, 0, 170, 255}, {0, 170, 170, 255}, {170, 170, 170, 255},
+		{85, 85, 85, 255}, {255, 85, 85, 255}, {85, 255, 85, 255}, {255, 255, 85, 255},
+		{85, 85, 255, 255}, {255, 85, 255, 255}, {85, 255, 255, 255}, {255, 255, 255, 255},
+	},
+	"tango": {
+		{46, 52, 54, 255}, {204, 0, 0, 255}, {78, 154, 6, 255}, {196, 160, 0, 255},
+		{52, 101, 164, 255}, {117, 80, 123, 255}, {6, 152, 154, 255}, {211, 215, 207, 255},
+		{85, 87, 83, 255}, {239, 41, 41, 255}, {138, 226, 52, 255}, {252, 233, 79, 255},
+		{114, 159, 207, 255}, {173, 127, 168, 255}, {52, 226, 226, 255}, {238, 238, 236, 255},
+	},
+	"solarized": {
+		{7, 54, 66, 255}, {220, 50, 47, 255}, {133, 153, 0, 255}, {181, 137, 0, 255},
+		{38, 139, 210, 255}, {211, 54, 130, 255}, {42, 161, 152, 255}, {238, 232, 213, 255},
+		{0, 43, 54, 255}, {203, 75, 22, 255}, {88, 110, 117, 255}, {101, 123, 131, 255},
+		{131, 148, 150, 255}, {108, 113, 196, 255}, {147, 161, 161, 255}, {253, 246, 227, 255},
+	},
+}
+
+// ANSIPalettes returns the names of the terminal palettes
+func ANSIPalettes() []string {
+	names := []string{ANSIPaletteStyle}
+	for name := range ansiPalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// SetANSI renders the source as the terminal output colored by the ANSI
+// escape sequences instead of highlighting it, in the named palette or the
+// palette derived from the style for ANSIPaletteStyle. The lines of the
+// panel are measured without the escape sequences.
+func (p *Panel) SetANSI(palette string) error {
+	if _, ok := ansiPalettes[palette]; !ok && palette != ANSIPaletteStyle && palette != "" {
+		return fmt.Errorf("unknown ANSI palette: %s", palette)
+	}
+
+	p.ansi = true
+	p.ansiPalette = palette
+	if len(p.lines) > 0 {
+		p.lines = strings.Split(stripANSI(strings.Join(p.lines, "\n")), "\n")
+		if p.lineRange.End > len(p.lines) {
+			p.lineRange.End = len(p.lines)
+		}
+	}
+	return nil
+}
+
+// ansiTokenBase is the first token type given to the graphic renditions of
+// the terminal output, beyond the token types of Chroma
+const ansiTokenBase = chroma.TokenType(1 << 20)
+
+// ansiColor is the color set by SGR, the default color or the index of the
+// 256 colors unless it is RGB
+type ansiColor struct {
+	isDefault bool
+	isRGB     bool
+	index     uint8
+	rgb       color.RGBA
+}
+
+var defaultANSIColor = ansiColor{isDefault: true}
+
+// ansiRendition is the graphic rendition of the text
+type ansiRendition struct {
+	fg, bg    ansiColor
+	bold      bool
+	faint     bool
+	italic    bool
+	underline bool
+	reverse   bool
+}
+
+// ansiRun is the text in a graphic rendition
+type ansiRun struct {
+	text      string
+	rendition ansiRendition
+}
+
+// ansiCell is a character on a line of the terminal in its graphic
+// rendition
+type ansiCell struct {
+	text      string
+	rendition ansiRendition
+}
+
+// parseANSI splits the terminal output into the runs of the text in the
+// graphic renditions set by SGR. The characters are written on the line at
+// the cursor, which carriage return, backspace and CHA move back to
+// overwrite them, and EL erases. The other escape sequences and control
+// characters are removed.
+func parseANSI(s string) []ansiRun {
+	var runs []ansiRun
+	var text strings.Builder
+	plain := ansiRendition{fg: defaultANSIColor, bg: defaultANSIColor}
+	r, current := plain, plain
+
+	emit := func(t string, rendition ansiRendition) {
+		if rendition != current && text.Len() > 0 {
+			runs = append(runs, ansiRun{text: text.String(), rendition: current})
+			text.Reset()
+		}
+		current = rendition
+		text.WriteString(t)
+	}
+
+	var line []ansiCell
+	col := 0
+	put := func(t string) {
+		for len(line) < col {
+			line = append(line, ansiCell{text: " ", rendition: plain})
+		}
+		if col < len(line) {
+			line[col] = ansiCell{text: t, rendition: r}
+		} else {
+			line = append(line, ansiCell{text: t, rendition: r})
+		}
+		col++
+	}
+	endLine := func() {
+		for _, c := range line {
+			emit(c.text, c.rendition)
+		}
+		line, col = line[:0], 0
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 0x1b && i+1 < len(s) && s[i+1] == '[':
+			// CSI: parameters and intermediates up to the final byte
+			j := i + 2
+			for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+				j++
+			}
+			if j < len(s) {
+				params := s[i+2 : j]
+				switch s[j] {
+				case 'm':
+					r = r.apply(params)
+				case 'K':
+					line = eraseInLine(line, col, params, plain)
+				case 'G':
+					n, _ := strconv.Atoi(params)
+					if col = n - 1; col < 0 {
+						col = 0
+					}
+				}
+			}
+			i = j
+		case c == 0x1b && i+1 < len(s) && s[i+1] == ']':
+			// OSC: terminated by BEL or ST
+			j := i + 2
+			for j < len(s) && s[j] != 0x07 && !(s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\') {
+				j++
+			}
+			if j < len(s) && s[j] == 0x1b {
+				j++
+			}
+			i = j
+		case c == 0x1b:
+			// the other escape sequences of intermediates and a final byte
+			i++
+			for i < len(s) && s[i] >= 0x20 && s[i] <= 0x2f {
+				i++
+			}
+		case c == '\n':
+			endLine()
+			emit("\n", r)
+		case c == '\r':
+			col = 0
+		case c == '\b':
+			if col > 0 {
+				col--
+			}
+		case c == '\t' || c >= 0x20 && c != 0x7f:
+			_, n := utf8.DecodeRuneInString(s[i:])
+			put(s[i : i+n])
+			i += n - 1
+		}
+	}
+	endLine()
+	if text.Len() > 0 {
+		runs = append(runs, ansiRun{text: text.String(), rendition: current})
+	}
+	return runs
+}
+
+// eraseInLine returns the line erased by EL from the cursor to the end (0),
+// from the beginning to the cursor (1) or entirely (2)
+func eraseInLine(line []ansiCell, col int, params string, plain ansiRendition) []ansiCell {
+	n, _ := strconv.Atoi(params)
+	switch n {
+	case 0:
+		if col < len(line) {
+			line = line[:col]
+		}
+	case 1:
+		for i := 0; i <= col && i < len(line); i++ {
+			line[i] = ansiCell{text: " ", rendition: plain}
+		}
+	case 2:
+		line = line[:0]
+	}
+	return line
+}
+
+// stripANSI returns the text of the terminal output without the escape
+// sequences
+func stripANSI(s string) string {
+	var b strings.Builder
+	for _, run := range parseANSI(s) {
+		b.WriteString(run.text)
+	}
+	return b.String()
+}
+
+// apply returns the graphic rendition changed by the parameters of SGR
+func (r ansiRendition) apply(params string) ansiRendition {
+	// the sub parameters of 38:2::R:G:B are taken as parameters
+	fields := strings.FieldsFunc(params, func(c rune) bool { return c == ';' || c == ':' })
+	if len(fields) == 0 {
+		fields = []string{"0"}
+	}
+	codes := make([]int, len(fields))
+	for i, f := range fields {
+		codes[i], _ = strconv.Atoi(f)
+	}
+
+	for i := 0; i < len(codes); i++ {
+		switch code := codes[i]; {
+		case code == 0:
+			r = ansiRendition{fg: defaultANSIColor, bg: defaultANSIColor}
+		case code == 1:
+			r.bold = true
+		case code == 2:
+			r.faint = true
+		case code == 3:
+			r.italic = true
+		case code == 4:
+			r.underline = true
+		case code == 7:
+			r.reverse = true
+		case code == 22:
+			r.bold, r.faint = false, false
+		case code == 23:
+			r.italic = false
+		case code == 24:
+			r.underline = false
+		case code == 27:
+			r.reverse = false
+		case code >= 30 && code <= 37:
+			r.fg = ansiColor{index: uint8(code - 30)}
+		case code >= 40 && code <= 47:
+			r.bg = ansiColor{index: uint8(code - 40)}
+		case code >= 90 && code <= 97:
+			r.fg = ansiColor{index: uint8(code - 90 + 8)}
+		case code >= 100 && code <= 107:
+			r.bg = ansiColor{index: uint8(code - 100 + 8)}
+		case code == 39:
+			r.fg = defaultANSIColor
+		case code == 49:
+			r.bg = defaultANSIColor
+		case code == 38 || code == 48:
+			c, n, ok := extendedANSIColor(codes[i+1:])
+			i += n
+			if !ok {
+				continue
+			}
+			if code == 38 {
+				r.fg = c
+			} else {
+				r.bg = c
+			}
+		}
+	}
+	return r
+}
+
+// extendedANSIColor parses the 256 color (5;N) or the RGB color (2;R;G;B)
+// following 38 or 48, and returns the number of the parameters taken. The
+// color is not valid if it is malformed or its values are beyond 255.
+func extendedANSIColor(codes []int) (ansiColor, int, bool) {
+	inRange := func(values []int) bool {
+		for _, v := range values {
+			if v < 0 || v > 255 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(codes) >= 2 && codes[0] == 5 {
+		return ansiColor{index: uint8(codes[1])}, 2, inRange(codes[1:2])
+	}
+	if len(codes) >= 4 && codes[0] == 2 {
+		return ansiColor{isRGB: true, rgb: color.RGBA{uint8(codes[1]), uint8(codes[2]), uint8(codes[3]), 255}}, 4, inRange(codes[1:4])
+	}
+	return ansiColor{}, len(codes), false
+}
+
+// ansiTheme is the colors of the terminal output in a Chroma style
+type ansiTheme struct {
+	palette [16]color.RGBA
+	fg, bg  color.RGBA
+}
+
+// newANSITheme returns the theme of the named palette, or the palette
+// derived from the style, with the foreground and background of the style
+func newANSITheme(style *chroma.Style, name string) (*ansiTheme, error) {
+	t := &ansiTheme{
+		fg: color.RGBAModel.Convert(tokenColor(style, chroma.Text)).(color.RGBA),
+		bg: windowBackground(style),
+	}
+
+	switch name {
+	case "", ANSIPaletteStyle:
+		t.palette = stylePalette(style, t.fg, t.bg)
+	default:
+		palette, ok := ansiPalettes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown ANSI palette: %s", name)
+		}
+		t.palette = palette
+	}
+	return t, nil
+}
+
+// ansiHues are the hues of red, green, yellow, blue, magenta and cyan
+var ansiHues = [6]float64{0, 120, 60, 240, 300, 180}
+
+// stylePalette derives the terminal palette from the style. Each of the six
+// colors is the color of the style closest in hue, and black and white are
+// made from the foreground and the background.
+func stylePalette(style *chroma.Style, fg, bg color.RGBA) [16]color.RGBA {
+	var candidates []color.RGBA
+	for _, tt := range style.Types() {
+		c := style.Get(tt).Colour
+		if !c.IsSet() {
+			continue
+		}
+		rgb := color.RGBA{c.Red(), c.Green(), c.Blue(), 255}
+		if _, s, _ := hsl(rgb); s >= 0.3 {
+			candidates = append(candidates, rgb)
+		}
+	}
+	// the order of the types is random
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		return a.R < b.R || a.R == b.R && (a.G < b.G || a.G == b.G && a.B < b.B)
+	})
+
+	dark, light := fg, bg
+	if luminance(dark) > luminance(light) {
+		dark, light = light, dark
+	}
+
+	var p [16]color.RGBA
+	xterm := ansiPalettes["xterm"]
+	for i, hue := range ansiHues {
+		c, best := xterm[i+1], 30.0
+		for _, cand := range candidates {
+			h, _, _ := hsl(cand)
+			if d := hueDistance(h, hue); d < best {
+				c, best = cand, d
+			}
+		}
+		p[i+1] = c
+		p[i+9] = mixRGBA(c, color.RGBA{255, 255, 255, 255}, 0.25)
+	}
+	p[0] = dark
+	p[7] = mixRGBA(light, dark, 0.15)
+	p[8] = mixRGBA(dark, light, 0.4)
+	p[15] = light
+	return p
+}
+
+// color returns the color of c in the theme, or def for the default color
+func (t *ansiTheme) color(c ansiColor, def color.RGBA) color.RGBA {
+	switch {
+	case c.isDefault:
+		return def
+	case c.isRGB:
+		return c.rgb
+	case c.index < 16:
+		return t.palette[c.index]
+	case c.index < 232:
+		// the 6x6x6 color cube
+		levels := [6]uint8{0, 95, 135, 175, 215, 255}
+		i := c.index - 16
+		return color.RGBA{levels[i/36], levels[i/6%6], levels[i%6], 255}
+	default:
+		v := 8 + 10*(c.index-232)
+		return color.RGBA{v, v, v, 255}
+	}
+}
+
+// entry returns the style entry of the graphic rendition
+func (t *ansiTheme) entry(r ansiRendition) chroma.StyleEntry {
+	fg, bg := t.color(r.fg, t.fg), t.color(r.bg, t.bg)
+	if r.reverse {
+		fg, bg = bg, fg
+	}
+	if r.faint {
+		fg = mixRGBA(fg, bg, 0.4)
+	}
+
+	e := chroma.StyleEntry{
+		Colour:    chroma.NewColour(fg.R, fg.G, fg.B),
+		Bold:      chroma.No,
+		Italic:    chroma.No,
+		Underline: chroma.No,
+	}
+	// the default background is the window, which the text is drawn on
+	if bg != t.bg {
+		e.Background = chroma.NewColour(bg.R, bg.G, bg.B)
+	}
+	if r.bold {
+		e.Bold = chroma.Yes
+	}
+	if r.italic {
+		e.Italic = chroma.Yes
+	}
+	if r.underline {
+		e.Underline = chroma.Yes
+	}
+	return e
+}
+
+// ansiTokens returns the tokens of the terminal output and the style giving
+// their graphic renditions in the theme of the palette
+func ansiTokens(s string, style *chroma.Style, palette string) (*chroma.Style, []chroma.Token, error) {
+	theme, err := newANSITheme(style, palette)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	builder := style.Builder()
+	types := make(map[ansiRendition]chroma.TokenType)
+	var tokens []chroma.Token
+	for _, run := range parseANSI(s) {
+		tt, ok := types[run.rendition]
+		if !ok {
+			tt = ansiTokenBase + chroma.TokenType(len(types))
+			types[run.rendition] = tt
+			builder.AddEntry(tt, theme.entry(run.rendition))
+		}
+		tokens = append(tokens, chroma.Token{Type: tt, Value: run.text})
+	}
+
+	ansiStyle, err := builder.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ansiStyle, tokens, nil
+}
+
+// hsl returns the hue in degrees, the saturation and the lightness of c
+func hsl(c color.RGBA) (h, s, l float64) {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	max, min := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	d := max - min
+	if d == 0 {
+		return 0, 0, l
+	}
+	s = d / (1 - math.Abs(2*l-1))
+
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, s, l
+}
+
+// hueDistance returns the angle between the hues
+func hueDistance(a, b float64) float64 {
+	d := math.Abs(a - b)
+	return math.Min(d, 360-d)
+}
+
+// luminance returns the relative luminance of c
+func luminance(c color.RGBA) float64 {
+	return 0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)
+}
+
+// mixRGBA returns the color of a mixed with b by t from 0 to 1
+func mixRGBA(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
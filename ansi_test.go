@@ -0,0 +1,131 @@
+package germanium
+
+import (
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+func TestParseANSI(t *testing.T) {
+	plain := ansiRendition{fg: defaultANSIColor, bg: defaultANSIColor}
+	red := plain
+	red.fg = ansiColor{index: 1}
+
+	tests := []struct {
+		desc  string
+		input string
+		want  []ansiRun
+	}{
+		{
+			desc:  "plain",
+			input: "hello\n",
+			want:  []ansiRun{{text: "hello\n", rendition: plain}},
+		},
+		{
+			desc:  "reset",
+			input: "\x1b[31mred\x1b[0m plain\x1b[31mred\x1b[m",
+			want: []ansiRun{
+				{text: "red", rendition: red},
+				{text: " plain", rendition: plain},
+				{text: "red", rendition: red},
+			},
+		},
+		{
+			desc:  "attributes",
+			input: "\x1b[1;3;4;7;91;100mA\x1b[22;23;24;27;39;49mB",
+			want: []ansiRun{
+				{text: "A", rendition: ansiRendition{fg: ansiColor{index: 9}, bg: ansiColor{index: 8}, bold: true, italic: true, underline: true, reverse: true}},
+				{text: "B", rendition: plain},
+			},
+		},
+		{
+			desc:  "256 colors",
+			input: "\x1b[38;5;208;48;5;17mA",
+			want:  []ansiRun{{text: "A", rendition: ansiRendition{fg: ansiColor{index: 208}, bg: ansiColor{index: 17}}}},
+		},
+		{
+			desc:  "truecolor",
+			input: "\x1b[38;2;1;2;3mA\x1b[48:2:4:5:6mB",
+			want: []ansiRun{
+				{text: "A", rendition: ansiRendition{fg: ansiColor{isRGB: true, rgb: color.RGBA{1, 2, 3, 255}}, bg: defaultANSIColor}},
+				{text: "B", rendition: ansiRendition{fg: ansiColor{isRGB: true, rgb: color.RGBA{1, 2, 3, 255}}, bg: ansiColor{isRGB: true, rgb: color.RGBA{4, 5, 6, 255}}}},
+			},
+		},
+		{
+			desc:  "out of range colors",
+			input: "\x1b[31;38;5;256mA\x1b[48;2;1;300;3mB",
+			want:  []ansiRun{{text: "AB", rendition: red}},
+		},
+		{
+			desc:  "carriage return",
+			input: "10%\r100%\nabcdef\r\x1b[31mXY\x1b[0m\n",
+			want: []ansiRun{
+				{text: "100%\n", rendition: plain},
+				{text: "XY", rendition: red},
+				{text: "cdef\n", rendition: plain},
+			},
+		},
+		{
+			desc:  "erase and backspace",
+			input: "loading...\r\x1b[Kdone\nab\bc\x1b[5Gd\n",
+			want:  []ansiRun{{text: "done\nac  d\n", rendition: plain}},
+		},
+		{
+			desc:  "other sequences",
+			input: "\x1b]0;title\x07\x1b[2K\x1b[1Gdone\r\n\x1b]8;;https://example.com\x1b\\link\x1b(B\x07",
+			want:  []ansiRun{{text: "done\nlink", rendition: plain}},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseANSI(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestSetANSI(t *testing.T) {
+	p, err := NewImage(strings.NewReader("\x1b[31mred\x1b[0m\n10%\r100%"), nil, FontSizeBase, "dracula", "#aaaaff", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetANSI("xterm"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"red", "100%"}; !reflect.DeepEqual(p.lines, want) {
+		t.Errorf("lines = %q, want %q", p.lines, want)
+	}
+
+	if err := p.SetANSI("unknown"); err == nil {
+		t.Errorf("unknown palette is accepted")
+	}
+}
+
+func TestANSITokens(t *testing.T) {
+	style := styles.Get("dracula")
+	ansiStyle, tokens, err := ansiTokens("a\x1b[7mb\x1b[0mc", style, "xterm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 3 || tokens[0].Type != tokens[2].Type {
+		t.Fatalf("tokens = %v", tokens)
+	}
+
+	// the reversed text is drawn in the background color on the foreground
+	plain, reversed := ansiStyle.Get(tokens[0].Type), ansiStyle.Get(tokens[1].Type)
+	if reversed.Colour != style.Get(chroma.Background).Background {
+		t.Errorf("reversed foreground = %v, want %v", reversed.Colour, style.Get(chroma.Background).Background)
+	}
+	if reversed.Background != plain.Colour {
+		t.Errorf("reversed background = %v, want %v", reversed.Background, plain.Colour)
+	}
+
+	if _, _, err := ansiTokens("", style, "unknown"); err == nil {
+		t.Errorf("unknown palette is accepted")
+	}
+}
@@ -0,0 +1,193 @@
+package germanium
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"time"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// encodeAPNG encodes the frames into the APNG looping forever, with the
+// pHYs chunk of the resolution unless dpi is 0. Every frame is 8 bit RGBA,
+// as the frames of an APNG share the color type of the IHDR chunk.
+func encodeAPNG(w io.Writer, frames []frame, dpi float64) error {
+	size := frames[0].img.Rect.Size()
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(size.Y))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // truecolor with alpha
+	buf.Write(pngChunk("IHDR", ihdr))
+
+	if dpi != 0 {
+		buf.Write(physChunk(dpi))
+	}
+
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	// the number of plays is 0 to loop forever
+	buf.Write(pngChunk("acTL", actl))
+
+	var seq uint32
+	for i, f := range frames {
+		r := f.img.Rect
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(r.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(r.Dy()))
+		binary.BigEndian.PutUint32(fctl[12:], uint32(r.Min.X))
+		binary.BigEndian.PutUint32(fctl[16:], uint32(r.Min.Y))
+		num, den := apngDelay(f.delay)
+		binary.BigEndian.PutUint16(fctl[20:], num)
+		binary.BigEndian.PutUint16(fctl[22:], den)
+		// the region is kept for the next frame, and replaced by this one
+		fctl[24] = 0 // APNG_DISPOSE_OP_NONE
+		fctl[25] = 0 // APNG_BLEND_OP_SOURCE
+		buf.Write(pngChunk("fcTL", fctl))
+		seq++
+
+		data, err := pngImageData(f.img)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			buf.Write(pngChunk("IDAT", data))
+			continue
+		}
+		fdat := make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(fdat, seq)
+		copy(fdat[4:], data)
+		buf.Write(pngChunk("fdAT", fdat))
+		seq++
+	}
+
+	buf.Write(pngChunk("IEND", nil))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// apngDelay returns the delay as the fraction of a second, in milliseconds
+// or in centiseconds if it is too long
+func apngDelay(d time.Duration) (num, den uint16) {
+	if ms := d / time.Millisecond; ms <= 0xffff {
+		return uint16(ms), 1000
+	}
+	cs := d / (10 * time.Millisecond)
+	if cs > 0xffff {
+		cs = 0xffff
+	}
+	return uint16(cs), 100
+}
+
+// pngImageData returns the compressed scanlines of the image in 8 bit RGBA.
+// Each scanline is filtered by the filter type giving the smallest sum of
+// the absolute values, as image/png does.
+func pngImageData(img *image.RGBA) ([]byte, error) {
+	b := img.Rect
+	n := b.Dx() * 4
+	prev, cur := make([]byte, n), make([]byte, n)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, 1+n)
+		filtered[i][0] = byte(i)
+	}
+
+	var out bytes.Buffer
+	zw := zlib.NewWriter(&out)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		// the pixels of PNG are not premultiplied by the alpha
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for i := 0; i < n; i += 4 {
+			a := row[i+3]
+			for c := 0; c < 3; c++ {
+				switch a {
+				case 0xff:
+					cur[i+c] = row[i+c]
+				case 0:
+					cur[i+c] = 0
+				default:
+					cur[i+c] = byte(uint32(row[i+c]) * 0xff / uint32(a))
+				}
+			}
+			cur[i+3] = a
+		}
+
+		if _, err := zw.Write(filterScanline(&filtered, cur, prev)); err != nil {
+			return nil, err
+		}
+		prev, cur = cur, prev
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// filterScanline filters the scanline of 4 bytes per pixel by each filter
+// type into filtered, and returns the one of the smallest sum
+func filterScanline(filtered *[5][]byte, cur, prev []byte) []byte {
+	const bpp = 4
+	best, bestSum := 0, -1
+	for ft := range filtered {
+		out := filtered[ft][1:]
+		sum := 0
+		for i := range cur {
+			var left, upLeft int
+			if i >= bpp {
+				left, upLeft = int(cur[i-bpp]), int(prev[i-bpp])
+			}
+			up := int(prev[i])
+
+			var pred int
+			switch ft {
+			case 1: // sub
+				pred = left
+			case 2: // up
+				pred = up
+			case 3: // average
+				pred = (left + up) / 2
+			case 4: // paeth
+				pred = paeth(left, up, upLeft)
+			}
+			out[i] = cur[i] - byte(pred)
+			if v := int(int8(out[i])); v < 0 {
+				sum -= v
+			} else {
+				sum += v
+			}
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = ft, sum
+		}
+	}
+	return filtered[best]
+}
+
+// paeth returns the Paeth predictor of the left, upper and upper left bytes
+func paeth(a, b, c int) int {
+	p := a + b - c
+	pa, pb, pc := abs(p-a), abs(p-b), abs(p-c)
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,321 @@
+package germanium
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// BackgroundTransparent is the background color leaving the canvas around
+// the window transparent
+const BackgroundTransparent = "transparent"
+
+// background image modes
+const (
+	// BackgroundCover scales the image to cover the whole canvas
+	BackgroundCover = "cover"
+	// BackgroundContain scales the image to fit in the canvas
+	BackgroundContain = "contain"
+	// BackgroundTile repeats the image in its original size
+	BackgroundTile = "tile"
+)
+
+// ColorStop is a color at the offset (0.0 to 1.0) along a gradient
+type ColorStop struct {
+	Color  color.NRGBA
+	Offset float64
+}
+
+// Gradient is a linear or radial gradient
+type Gradient struct {
+	Radial bool
+	// Angle of a linear gradient in degrees, 0 goes to top and 90 to right
+	Angle float64
+	Stops []ColorStop
+}
+
+// ParseGradient parses a gradient such as '#ff0000,#0000ff@45deg' or
+// 'radial:#ffffff,#aaaaff 60%,#0000ff'. Each stop is a hex color with an
+// optional offset, stops without offset are spread evenly.
+func ParseGradient(s string) (*Gradient, error) {
+	g := &Gradient{Angle: 180}
+
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, "radial:"):
+		g.Radial = true
+		s = strings.TrimPrefix(s, "radial:")
+	case strings.HasPrefix(s, "linear:"):
+		s = strings.TrimPrefix(s, "linear:")
+	}
+
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		if g.Radial {
+			return nil, fmt.Errorf("radial gradient has no angle: %s", s)
+		}
+		angle, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s[i+1:]), "deg"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient angle: %s", s[i+1:])
+		}
+		g.Angle = angle
+		s = s[:i]
+	}
+
+	stops := strings.Split(s, ",")
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("gradient needs at least two colors: %s", s)
+	}
+
+	for i, stop := range stops {
+		fields := strings.Fields(stop)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid gradient color stop: %q", stop)
+		}
+
+		c, err := parseColor(fields[0])
+		if err != nil {
+			return nil, err
+		}
+
+		offset := float64(i) / float64(len(stops)-1)
+		if len(fields) == 2 {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gradient color stop offset: %s", fields[1])
+			}
+			offset = percent / 100
+		}
+
+		g.Stops = append(g.Stops, ColorStop{Color: c, Offset: offset})
+	}
+
+	return g, nil
+}
+
+// at returns the color of the gradient at t
+func (g *Gradient) at(t float64) color.NRGBA {
+	if t <= g.Stops[0].Offset {
+		return g.Stops[0].Color
+	}
+	for i := 1; i < len(g.Stops); i++ {
+		from, to := g.Stops[i-1], g.Stops[i]
+		if t > to.Offset {
+			continue
+		}
+		if to.Offset <= from.Offset {
+			return to.Color
+		}
+		return lerpColor(from.Color, to.Color, (t-from.Offset)/(to.Offset-from.Offset))
+	}
+	return g.Stops[len(g.Stops)-1].Color
+}
+
+// line returns the start and end points of a linear gradient on rect,
+// following the CSS gradient line
+func (g *Gradient) line(rect image.Rectangle) (x1, y1, x2, y2 float64) {
+	a := g.Angle * math.Pi / 180
+	sin, cos := math.Sin(a), math.Cos(a)
+	w, h := float64(rect.Dx()), float64(rect.Dy())
+	half := (math.Abs(w*sin) + math.Abs(h*cos)) / 2
+
+	cx, cy := float64(rect.Min.X)+w/2, float64(rect.Min.Y)+h/2
+	return cx - sin*half, cy + cos*half, cx + sin*half, cy - cos*half
+}
+
+// draw composites the gradient over rect of img
+func (g *Gradient) draw(img draw.Image, rect image.Rectangle) {
+	grad := image.NewNRGBA(rect)
+	cx, cy := float64(rect.Min.X)+float64(rect.Dx())/2, float64(rect.Min.Y)+float64(rect.Dy())/2
+	r := math.Hypot(float64(rect.Dx()), float64(rect.Dy())) / 2
+	x1, y1, x2, y2 := g.line(rect)
+	dx, dy := x2-x1, y2-y1
+	length2 := dx*dx + dy*dy
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+
+			var t float64
+			if g.Radial {
+				t = math.Hypot(px-cx, py-cy) / r
+			} else {
+				t = ((px-x1)*dx + (py-y1)*dy) / length2
+			}
+			grad.SetNRGBA(x, y, g.at(t))
+		}
+	}
+	draw.Draw(img, rect, grad, rect.Min, draw.Over)
+}
+
+func lerpColor(a, b color.NRGBA, t float64) color.NRGBA {
+	lerp := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.NRGBA{R: lerp(a.R, b.R), G: lerp(a.G, b.G), B: lerp(a.B, b.B), A: lerp(a.A, b.A)}
+}
+
+// SetBackgroundGradient sets the gradient drawn over the background color
+func (p *Panel) SetBackgroundGradient(g *Gradient) {
+	p.bgGradient = g
+}
+
+// SetBackgroundImage sets the image drawn over the background color and
+// gradient with the mode, one of cover, contain and tile
+func (p *Panel) SetBackgroundImage(img image.Image, mode string) error {
+	switch mode {
+	case "":
+		mode = BackgroundCover
+	case BackgroundCover, BackgroundContain, BackgroundTile:
+	default:
+		return fmt.Errorf("unsupported background image mode: %s", mode)
+	}
+
+	p.bgImage = img
+	p.bgImageMode = mode
+	return nil
+}
+
+// parseColor parses the hex color, whose channels ParseHexColor returns
+// without premultiplying them by the alpha
+func parseColor(s string) (color.NRGBA, error) {
+	c, err := ParseHexColor(s)
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	return color.NRGBA{R: c.R, G: c.G, B: c.B, A: c.A}, nil
+}
+
+// backgroundColor returns the background color of the image
+func (p *Panel) backgroundColor() (color.NRGBA, error) {
+	if p.bgColor == BackgroundTransparent {
+		return color.NRGBA{}, nil
+	}
+	return parseColor(p.bgColor)
+}
+
+// drawBackground draws the background color, gradient and image on the panel
+func (p *Panel) drawBackground(bg color.NRGBA) {
+	draw.Draw(p.img, p.img.Rect, image.NewUniform(bg), image.Point{}, draw.Src)
+
+	if p.bgGradient != nil {
+		p.bgGradient.draw(p.img, p.img.Rect)
+	}
+
+	if p.bgImage != nil {
+		p.drawBackgroundImage()
+	}
+}
+
+func (p *Panel) drawBackgroundImage() {
+	canvas := p.img.Rect
+	src := p.bgImage.Bounds()
+
+	if p.bgImageMode == BackgroundTile {
+		// the tiles are scaled with the image, once
+		tile, size := p.bgImage, p.tileSize()
+		if size != src.Size() {
+			scaled := image.NewRGBA(image.Rectangle{Max: size})
+			xdraw.CatmullRom.Scale(scaled, scaled.Rect, p.bgImage, src, draw.Src, nil)
+			tile, src = scaled, scaled.Rect
+		}
+		for y := canvas.Min.Y; y < canvas.Max.Y; y += size.Y {
+			for x := canvas.Min.X; x < canvas.Max.X; x += size.X {
+				draw.Draw(p.img, image.Rect(x, y, x+size.X, y+size.Y), tile, src.Min, draw.Over)
+			}
+		}
+		return
+	}
+
+	xdraw.CatmullRom.Scale(p.img, scaledRect(canvas, src, p.bgImageMode), p.bgImage, src, draw.Over, nil)
+}
+
+// tileSize returns the size of the tiles of the background image multiplied
+// by the scale, at least 1 pixel
+func (p *Panel) tileSize() image.Point {
+	size := p.bgImage.Bounds().Size()
+	size.X = scalePixels(size.X, p.scale)
+	size.Y = scalePixels(size.Y, p.scale)
+	if size.X < 1 {
+		size.X = 1
+	}
+	if size.Y < 1 {
+		size.Y = 1
+	}
+	return size
+}
+
+// scaledRect returns the rectangle centered on canvas where the image is
+// scaled into in the mode
+func scaledRect(canvas, src image.Rectangle, mode string) image.Rectangle {
+	sx := float64(canvas.Dx()) / float64(src.Dx())
+	sy := float64(canvas.Dy()) / float64(src.Dy())
+
+	scale := math.Max(sx, sy)
+	if mode == BackgroundContain {
+		scale = math.Min(sx, sy)
+	}
+
+	w := int(math.Round(float64(src.Dx()) * scale))
+	h := int(math.Round(float64(src.Dy()) * scale))
+	x := canvas.Min.X + (canvas.Dx()-w)/2
+	y := canvas.Min.Y + (canvas.Dy()-h)/2
+	return image.Rect(x, y, x+w, y+h)
+}
+
+// svgBackground returns the SVG markup of the background gradient and image
+func (p *Panel) svgBackground() (string, error) {
+	var b strings.Builder
+	width, height := p.img.Rect.Dx(), p.img.Rect.Dy()
+
+	if g := p.bgGradient; g != nil {
+		if g.Radial {
+			fmt.Fprintf(&b, `<radialGradient id="background-gradient" gradientUnits="userSpaceOnUse" cx="%g" cy="%g" r="%g">`,
+				float64(width)/2, float64(height)/2, math.Hypot(float64(width), float64(height))/2)
+		} else {
+			x1, y1, x2, y2 := g.line(p.img.Rect)
+			fmt.Fprintf(&b, `<linearGradient id="background-gradient" gradientUnits="userSpaceOnUse" x1="%g" y1="%g" x2="%g" y2="%g">`,
+				x1, y1, x2, y2)
+		}
+		for _, s := range g.Stops {
+			fmt.Fprintf(&b, `<stop offset="%g" stop-color="%s"/>`, s.Offset, svgColor(s.Color))
+		}
+		if g.Radial {
+			b.WriteString("</radialGradient>\n")
+		} else {
+			b.WriteString("</linearGradient>\n")
+		}
+		fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="url(#background-gradient)"/>`+"\n", width, height)
+	}
+
+	if p.bgImage != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, p.bgImage); err != nil {
+			return "", err
+		}
+		src := p.bgImage.Bounds()
+		href := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+
+		switch p.bgImageMode {
+		case BackgroundTile:
+			size := p.tileSize()
+			fmt.Fprintf(&b, `<pattern id="background-image" patternUnits="userSpaceOnUse" width="%d" height="%d"><image width="%d" height="%d" preserveAspectRatio="none" href="%s"/></pattern>`+"\n",
+				size.X, size.Y, size.X, size.Y, href)
+			fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="url(#background-image)"/>`+"\n", width, height)
+		default:
+			r := scaledRect(p.img.Rect, src, p.bgImageMode)
+			fmt.Fprintf(&b, `<svg width="%d" height="%d"><image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="none" href="%s"/></svg>`+"\n",
+				width, height, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), href)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,258 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/matsuyoshi30/germanium"
+)
+
+// batchFile is an input file of batch mode and its output image
+type batchFile struct {
+	input  string
+	output string
+	err    error
+}
+
+// batch renders the files matching the patterns into the output directory
+// in parallel, and reports the files failed to render
+func batch(opts Options, patterns []string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("specify the files to render in batch mode")
+	}
+	if opts.Clipboard {
+		return fmt.Errorf("batch mode cannot copy images to clipboard")
+	}
+
+	format, err := outputFormat(opts)
+	if err != nil {
+		return err
+	}
+	files, err := batchFiles(patterns, opts.OutDir, format)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files match: %s", strings.Join(patterns, " "))
+	}
+
+	// the fonts and the background image are loaded once, and each worker
+	// has its own faces
+	a, err := loadAssets(opts)
+	if err != nil {
+		return err
+	}
+	fontSize, err := parseFontSize(opts.FontSize)
+	if err != nil {
+		return err
+	}
+	lexers := germanium.NewLexerCache()
+
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > len(files) {
+		jobs = len(files)
+	}
+
+	queue := make(chan *batchFile)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		renderOpts, err := renderOptions(opts, "", format, a, fontSize)
+		if err != nil {
+			return err
+		}
+		renderOpts = append(renderOpts,
+			germanium.WithLexerCache(lexers),
+		)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range queue {
+				f.err = renderFile(opts, f, renderOpts)
+			}
+		}()
+	}
+	for i := range files {
+		// the files whose output is taken are not rendered
+		if files[i].err == nil {
+			queue <- &files[i]
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, f := range files {
+		if f.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", f.input, f.err)
+		}
+	}
+	fmt.Printf("rendered %d of %d files into %s\n", len(files)-failed, len(files), opts.OutDir)
+
+	if failed > 0 {
+		return fmt.Errorf("failed to render %d files", failed)
+	}
+	return nil
+}
+
+// renderFile renders the input file into its output image
+func renderFile(opts Options, f *batchFile, renderOpts []germanium.Option) error {
+	in, err := os.Open(f.input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if opts.RemoveExtraIndent {
+		r = removeExtraIndent(r)
+	}
+	if !opts.Diff {
+		renderOpts = append(renderOpts[:len(renderOpts):len(renderOpts)], germanium.WithFilename(f.input))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.output), 0o755); err != nil {
+		return err
+	}
+
+	return writeFile(f.output, func(w io.Writer) error {
+		return germanium.Render(context.Background(), w, r, renderOpts...)
+	})
+}
+
+// batchFiles returns the files matching the patterns, whose output images
+// keep their paths from the directory of the pattern in the output
+// directory, with the extension of the format
+func batchFiles(patterns []string, outDir, format string) ([]batchFile, error) {
+	var files []batchFile
+	inputs := make(map[string]bool)
+	outputs := make(map[string]string)
+
+	for _, pattern := range patterns {
+		base, matches, err := glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range matches {
+			if inputs[path] {
+				continue
+			}
+			inputs[path] = true
+
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return nil, err
+			}
+			output := filepath.Join(outDir, strings.TrimSuffix(rel, filepath.Ext(rel))+"."+format)
+
+			f := batchFile{input: path, output: output}
+			if other, ok := outputs[output]; ok {
+				f.err = fmt.Errorf("output %s is also written by %s", output, other)
+			} else {
+				outputs[output] = path
+			}
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+// glob returns the directory without wildcards at the head of the pattern
+// and the files matching the pattern, where '**' matches any number of
+// directories
+func glob(pattern string) (string, []string, error) {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+
+	n := 0
+	for n < len(segments)-1 && !hasMeta(segments[n]) {
+		n++
+	}
+	base := "."
+	if n > 0 {
+		base = filepath.FromSlash(strings.Join(segments[:n], "/") + "/")
+	}
+	rest := segments[n:]
+
+	// without '**', the directories deeper than the pattern are not walked
+	recursive := false
+	for _, s := range rest {
+		recursive = recursive || s == "**"
+	}
+
+	var matches []string
+	err := filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		depth := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if rel != "." && !recursive && len(depth) >= len(rest) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		ok, err := matchSegments(rest, depth)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return base, matches, nil
+}
+
+// hasMeta reports whether the segment of the pattern has wildcards
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
+
+// matchSegments reports whether the path segments match the pattern
+// segments
+func matchSegments(pattern, path []string) (bool, error) {
+	if len(pattern) == 0 {
+		return len(path) == 0, nil
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if ok, err := matchSegments(pattern[1:], path[i:]); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	if len(path) == 0 {
+		return false, nil
+	}
+	ok, err := filepath.Match(pattern[0], path[0])
+	if !ok || err != nil {
+		return false, err
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
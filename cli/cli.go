@@ -3,8 +3,11 @@ package cli
 import (
 	"bufio"
 	"bytes"
-	_ "embed" // embed font data
+	"context"
 	"fmt"
+	"image"
+	_ "image/jpeg" // decode background image
+	_ "image/png"  // decode background image
 	"io"
 	"math"
 	"os"
@@ -35,8 +38,14 @@ var (
 func Run() (err error) {
 	var opts Options
 
-	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
-	parser.Usage = fmt.Sprintf(Usage, name)
+	parser := newParser(&opts)
+
+	// the configuration files give the defaults of the flags
+	files := configFiles()
+	preset := presetArg(os.Args[1:])
+	if err := applyConfig(parser, files, preset); err != nil {
+		return err
+	}
 
 	args, err := parser.Parse()
 	if err != nil {
@@ -56,6 +65,27 @@ func Run() (err error) {
 		return nil
 	}
 
+	// the file named like a subcommand is rendered, since the file to render
+	// is the only argument
+	if len(args) != 1 || !isFile(args[0]) {
+		if len(args) == 2 && args[0] == "config" && args[1] == "print" {
+			printConfig(os.Stdout, parser, files, preset)
+			return nil
+		}
+
+		if len(args) > 0 && args[0] == "batch" {
+			return batch(opts, args[1:])
+		}
+
+		if len(args) == 2 && args[0] == "markdown" {
+			return markdown(opts, args[1])
+		}
+
+		if len(args) == 1 && args[0] == "serve" {
+			return serve(opts)
+		}
+	}
+
 	var filename string
 	if len(args) > 0 {
 		filename = args[0]
@@ -79,86 +109,213 @@ func Run() (err error) {
 		return nil
 	}
 
-	var r io.Reader
 	switch filename {
 	case "", "-":
-		if opts.Language == "" {
+		if opts.Language == "" && !opts.Diff && !opts.ANSI {
 			err = fmt.Errorf("specify language in order to use stdin")
 			return
 		}
-		r = os.Stdin
+		if opts.Watch {
+			return fmt.Errorf("specify input file in order to use --watch")
+		}
+		return run(opts, os.Stdin, filename)
 	default:
+		var lines string
 		if _, err := os.Stat(filename); os.IsNotExist(err) {
-			return err
+			// FILE:START-END renders the line range of the file
+			name, l, ok := splitLineRange(filename)
+			if !ok {
+				return err
+			}
+			if _, err := os.Stat(name); err != nil {
+				return err
+			}
+			filename = name
+			lines = l
+			if opts.Lines == "" {
+				opts.Lines = lines
+			}
 		}
 
-		file, err := os.Open(filename)
-		if err != nil {
-			return err
+		if opts.Watch {
+			// the options are parsed again as the configuration files may change
+			return watch(append(configPaths(), filename), func() error {
+				opts, err := reloadOptions(preset)
+				if err != nil {
+					return err
+				}
+				if opts.Lines == "" {
+					opts.Lines = lines
+				}
+				return runFile(opts, filename)
+			})
 		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				return
-			}
-		}()
-		r = file
+
+		return runFile(opts, filename)
 	}
+}
 
-	return run(opts, r, filename)
+// newParser returns the parser of the command line arguments into opts
+func newParser(opts *Options) *flags.Parser {
+	parser := flags.NewParser(opts, flags.HelpFlag|flags.PassDoubleDash)
+	parser.Usage = fmt.Sprintf(Usage, name)
+	return parser
+}
+
+// runFile renders the source code file
+func runFile(opts Options, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return run(opts, file, filename)
 }
 
 func run(opts Options, r io.Reader, filename string) error {
-	var (
-		out io.ReadWriter
-		err error
-	)
+	format, err := outputFormat(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Clipboard && format != germanium.FormatPNG {
+		return fmt.Errorf("only png can be copied to clipboard")
+	}
 
-	if opts.Clipboard {
-		out = &bytes.Buffer{}
-	} else {
-		if filepath.IsAbs(opts.Output) {
-			out, err = os.Create(opts.Output)
-			if err != nil {
-				return err
-			}
-		} else {
-			currentDir, err := os.Getwd()
-			if err != nil {
-				return err
-			}
+	a, err := loadAssets(opts)
+	if err != nil {
+		return err
+	}
 
-			out, err = os.Create(filepath.Join(currentDir, opts.Output))
-			if err != nil {
-				return err
-			}
-		}
+	fontSize, err := parseFontSize(opts.FontSize)
+	if err != nil {
+		return err
 	}
 
-	var fontData []byte
-	if opts.Font != DefaultFont {
-		fontPath, err := findfont.Find(opts.Font + ".ttf")
-		if err != nil {
-			return err
-		}
+	if opts.RemoveExtraIndent {
+		r = removeExtraIndent(r)
+	}
 
-		fontData, err = os.ReadFile(fontPath)
-		if err != nil {
+	renderOpts, err := renderOptions(opts, filename, format, a, fontSize)
+	if err != nil {
+		return err
+	}
+
+	render := func(w io.Writer) error {
+		return germanium.Render(context.Background(), w, r, renderOpts...)
+	}
+
+	if opts.Clipboard {
+		var out bytes.Buffer
+		if err := render(&out); err != nil {
 			return err
 		}
+		return clipboard.Write(&out)
+	}
+
+	// - streams the image to stdout
+	if opts.Output == "-" {
+		return render(os.Stdout)
 	}
 
-	fontSize := germanium.FontSizeBase
-	if opts.FontSize != "" {
-		fontSize, err = strconv.ParseFloat(opts.FontSize, 64)
+	output := opts.Output
+	if !filepath.IsAbs(output) {
+		currentDir, err := os.Getwd()
 		if err != nil {
 			return err
 		}
+		output = filepath.Join(currentDir, output)
 	}
 
-	face, err := loadFont(fontData, fontSize)
+	return writeFile(output, render)
+}
+
+// writeFile writes the file atomically, by renaming the temporary file
+// written in the same directory, so that the readers never see the file
+// partially written
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// parseFontSize parses the font size flag, FontSizeBase if empty
+func parseFontSize(s string) (float64, error) {
+	if s == "" {
+		return germanium.FontSizeBase, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// removeExtraIndent returns the source without the indentation common to
+// all the lines
+func removeExtraIndent(r io.Reader) io.Reader {
+	// Remove extra indent, little bit hacky and could
+	extra_indent := math.MaxInt
+
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+
+	// check minimum indentation
+	for scanner.Scan() {
+		lines = append(lines, strings.ReplaceAll(scanner.Text(), "\t", "    ")) // replace tab to whitespace
+		line := lines[len(lines)-1]
+
+		// Skip line with no chars
+		if len(line) == 0 {
+			continue
+		}
+
+		line_indent := len(line) - len(strings.TrimLeft(string(line), " "))
+
+		if line_indent < extra_indent {
+			extra_indent = line_indent
+		}
+	}
+
+	// remove extra indent for each lines
+	for index := range lines {
+		// Skip line with no chars
+		if len(lines[index]) == 0 {
+			continue
+		}
+
+		lines[index] = lines[index][extra_indent:]
+	}
+
+	// Export the new reader without the extra indentation
+	return strings.NewReader(strings.Join(lines, "\n"))
+}
+
+// renderOptions returns the options of the renderer specified by the flags
+// with the assets loaded for them. The faces are new for each call, since
+// they are not safe for concurrent use.
+func renderOptions(opts Options, filename, format string, a *assets, fontSize float64) ([]germanium.Option, error) {
+	if opts.Diff && (opts.RemoveExtraIndent || opts.Lines != "" || opts.HighlightLines != "") {
+		return nil, fmt.Errorf("--remove-extra-indent, --lines and --highlight-lines cannot be used with --diff")
+	}
+	if opts.Scale <= 0 {
+		return nil, fmt.Errorf("invalid scale: %g", opts.Scale)
+	}
+	// the faces are made at the size of the pixels in the scaled image
+	scale := opts.Scale
 
 	// set default style to dracula
 	style := `dracula`
@@ -166,91 +323,332 @@ func run(opts Options, r io.Reader, filename string) error {
 		style = opts.Style
 	}
 
-	// Remove extra indent, little bit hacky and could
-	if opts.RemoveExtraIndent {
-		extra_indent := math.MaxInt
+	renderOpts := []germanium.Option{
+		germanium.WithStyle(style),
+		germanium.WithBackground(opts.BackgroundColor),
+		germanium.WithLineNumbers(!opts.NoLineNum),
+		germanium.WithFormat(format),
+		germanium.WithQuality(opts.Quality),
+		germanium.WithScale(scale),
+		germanium.WithFontFace(a.fonts.face(fontSize*scale), fontSize),
+		germanium.WithWidthMode(opts.CharWidth),
+		germanium.WithLanguage(opts.Language),
+		germanium.WithLayout(germanium.Layout{
+			PaddingX:     opts.PaddingX,
+			PaddingY:     opts.PaddingY,
+			InnerPadding: opts.InnerPadding,
+			LineSpacing:  opts.LineSpacing,
+		}),
+		germanium.WithShadow(germanium.Shadow{
+			Blur:    opts.ShadowBlur,
+			OffsetX: opts.ShadowOffsetX,
+			OffsetY: opts.ShadowOffsetY,
+			Spread:  opts.ShadowSpread,
+			Color:   opts.ShadowColor,
+		}),
+	}
 
-		var lines []string
+	if opts.Diff {
+		// the lexer is chosen from the file name in the diff
+		renderOpts = append(renderOpts, germanium.WithDiff())
+	} else {
+		renderOpts = append(renderOpts, germanium.WithFilename(filename))
+	}
 
-		scanner := bufio.NewScanner(r)
+	if opts.ANSI {
+		renderOpts = append(renderOpts, germanium.WithANSI(opts.ANSIPalette))
+	}
 
-		// check minimum indentation
-		for scanner.Scan() {
-			lines = append(lines, strings.ReplaceAll(scanner.Text(), "\t", "    ")) // replace tab to whitespace
-			line := lines[len(lines)-1]
+	windowStyle := germanium.WindowStyleNone
+	if !opts.NoWindowAccessBar {
+		var err error
+		windowStyle, err = germanium.GetWindowStyle(opts.WindowStyle)
+		if err != nil {
+			return nil, err
+		}
+	}
+	renderOpts = append(renderOpts,
+		germanium.WithWindowStyle(windowStyle),
+		germanium.WithCornerRadius(opts.CornerRadius),
+	)
 
-			// Skip line with no chars
-			if len(line) == 0 {
-				continue
-			}
+	if a.fonts.names[0] != DefaultFont {
+		bold, italic, boldItalic := a.fonts.variantFaces(fontSize * scale)
+		renderOpts = append(renderOpts, germanium.WithFontVariants(bold, italic, boldItalic))
+	}
 
-			line_indent := len(line) - len(strings.TrimLeft(string(line), " "))
+	if opts.Lines != "" {
+		ranges, err := germanium.ParseLineRanges(opts.Lines)
+		if err != nil {
+			return nil, err
+		}
+		if len(ranges) != 1 {
+			return nil, fmt.Errorf("specify a single line range: %s", opts.Lines)
+		}
+		renderOpts = append(renderOpts, germanium.WithLineRange(ranges[0]))
+	}
 
-			if line_indent < extra_indent {
-				extra_indent = line_indent
-			}
+	if opts.LineNumberStart != 0 {
+		if opts.LineNumberStart < 0 {
+			return nil, fmt.Errorf("invalid line number start: %d", opts.LineNumberStart)
 		}
+		renderOpts = append(renderOpts, germanium.WithLineNumberStart(opts.LineNumberStart))
+	}
 
-		// remove extra indent for each lines
-		for index := range lines {
-			// Skip line with no chars
-			if len(lines[index]) == 0 {
-				continue
-			}
+	if opts.Title != "" || opts.TitleFilename {
+		titleSize := fontSize * germanium.TitleFontScale
+		renderOpts = append(renderOpts, germanium.WithTitle(germanium.Title{
+			Text:     opts.Title,
+			Filename: opts.TitleFilename,
+			Color:    opts.TitleColor,
+			Face:     a.fonts.face(titleSize * scale),
+			FontSize: titleSize,
+		}))
+	}
 
-			lines[index] = lines[index][extra_indent:]
+	if opts.Animate != "" {
+		renderOpts = append(renderOpts, germanium.WithAnimation(germanium.Animation{
+			Mode:          opts.Animate,
+			CharsPerFrame: opts.CharsPerFrame,
+			Delay:         opts.FrameDelay,
+			Hold:          opts.Hold,
+			Cursor:        opts.Cursor,
+		}))
+	}
+
+	if opts.HighlightLines != "" {
+		lines, err := germanium.ParseLineRanges(opts.HighlightLines)
+		if err != nil {
+			return nil, err
 		}
+		renderOpts = append(renderOpts, germanium.WithHighlight(germanium.Highlight{
+			Lines: lines,
+			Color: opts.HighlightColor,
+			Dim:   opts.DimLines,
+		}))
+	}
 
-		// Export the new reader without the extra indentation
-		r = strings.NewReader(strings.Join(lines, "\n"))
+	if opts.BackgroundGradient != "" {
+		gradient, err := germanium.ParseGradient(opts.BackgroundGradient)
+		if err != nil {
+			return nil, err
+		}
+		renderOpts = append(renderOpts, germanium.WithBackgroundGradient(gradient))
 	}
 
-	var buf bytes.Buffer
-	src := io.TeeReader(r, &buf)
+	if a.background != nil {
+		renderOpts = append(renderOpts, germanium.WithBackgroundImage(a.background, opts.BackgroundImageMode))
+	}
 
-	image, err := germanium.NewImage(src, face, fontSize, style, opts.BackgroundColor, opts.NoWindowAccessBar, opts.NoLineNum)
-	if err != nil {
-		return err
+	if format == germanium.FormatSVG {
+		var embed []byte
+		if opts.EmbedFont {
+			embed = a.fonts.data[0]
+		}
+		renderOpts = append(renderOpts, germanium.WithSVGFont(strings.Join(a.fonts.families, ","), embed))
 	}
 
-	err = image.Draw()
-	if err != nil {
-		return err
+	return renderOpts, nil
+}
+
+// outputFormat returns the image format specified by the flag or the
+// extension of the output file
+func outputFormat(opts Options) (string, error) {
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.Output)), ".")
+	}
+
+	switch format {
+	case "jpg":
+		return germanium.FormatJPEG, nil
+	case "apng", "":
+		return germanium.FormatPNG, nil
+	case germanium.FormatPNG, germanium.FormatSVG, germanium.FormatJPEG, germanium.FormatGIF, germanium.FormatBMP, germanium.FormatWebP:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported format: %s", format)
+}
+
+// splitLineRange splits FILE:START-END into the file name and the line range
+func splitLineRange(arg string) (string, string, bool) {
+	i := strings.LastIndex(arg, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	if _, err := germanium.ParseLineRanges(arg[i+1:]); err != nil {
+		return "", "", false
 	}
+	return arg[:i], arg[i+1:], true
+}
 
-	err = image.Label(out, &buf, filename, opts.Language)
+// assets are the fonts and the background image of the options, loaded
+// once and shared by the renderers
+type assets struct {
+	fonts      *fontSet
+	background image.Image
+}
+
+// loadAssets loads the fonts and the background image of the options
+func loadAssets(opts Options) (*assets, error) {
+	fonts, err := loadFontSet(opts.Font)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	a := &assets{fonts: fonts}
 
-	if opts.Clipboard {
-		if err := clipboard.Write(out); err != nil {
-			return err
+	if opts.BackgroundImage != "" {
+		if a.background, err = loadImage(opts.BackgroundImage); err != nil {
+			return nil, err
 		}
 	}
+	return a, nil
+}
 
-	return nil
+// loadImage decodes PNG or JPEG image file
+func loadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return img, nil
 }
 
 // DefaultFont is default font name
-const DefaultFont = "Hack-Regular"
+const DefaultFont = germanium.DefaultFontName
 
-var (
-	//go:embed font/Hack-Regular.ttf
-	fontHack []byte
-)
+// isFile reports whether the path is an existing file
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// readFont reads the font data of the font name or the path to the font file
+func readFont(name string) ([]byte, error) {
+	if name == DefaultFont {
+		return germanium.DefaultFontData(), nil
+	}
 
-// LoadFont loads font data and returns font.Face
-func loadFont(data []byte, fontSize float64) (font.Face, error) {
-	fontData := fontHack
-	if len(data) > 0 {
-		fontData = data
+	if isFile(name) {
+		return os.ReadFile(name)
 	}
 
-	ft, err := truetype.Parse(fontData)
+	fontPath, err := findfont.Find(name + ".ttf")
 	if err != nil {
 		return nil, err
 	}
 
-	return truetype.NewFace(ft, &truetype.Options{Size: fontSize}), nil
+	return os.ReadFile(fontPath)
+}
+
+// fontSet is the fonts of the font flag, parsed once and shared by the
+// faces of any size. The fonts after the first one are the fallbacks for
+// missing glyphs.
+type fontSet struct {
+	names []string
+	// families are the family names of the fonts, referenced by SVG output
+	families []string
+	data     [][]byte
+	fonts    []*truetype.Font
+	// variants are the bold, italic and bold italic fonts of the family of
+	// the first font, nil if not found
+	variants [3]*truetype.Font
+}
+
+// loadFontSet reads and parses the comma separated fonts
+func loadFontSet(names string) (*fontSet, error) {
+	s := &fontSet{names: strings.Split(names, ",")}
+	for i, name := range s.names {
+		s.names[i] = strings.TrimSpace(name)
+		data, err := readFont(s.names[i])
+		if err != nil {
+			return nil, err
+		}
+		ft, err := truetype.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		s.data = append(s.data, data)
+		s.fonts = append(s.fonts, ft)
+		s.families = append(s.families, fontFamily(ft, s.names[i]))
+	}
+
+	if s.names[0] != DefaultFont {
+		variants, err := loadFontVariants(s.names[0])
+		if err != nil {
+			return nil, err
+		}
+		s.variants = variants
+	}
+	return s, nil
+}
+
+// fontFamily returns the family name in the name table of the font, or the
+// file name of the font without the extension if the table has none
+func fontFamily(ft *truetype.Font, name string) string {
+	if family := ft.Name(truetype.NameIDFontFamily); family != "" {
+		return family
+	}
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+// face returns a new face of the fonts at the font size, which is not safe
+// for concurrent use
+func (s *fontSet) face(fontSize float64) font.Face {
+	return newFace(s.fonts, fontSize)
+}
+
+// variantFaces returns new bold, italic and bold italic faces at the font
+// size, followed by the fallback fonts. The faces of the variants not found
+// are nil.
+func (s *fontSet) variantFaces(fontSize float64) (bold, italic, boldItalic font.Face) {
+	faces := make([]font.Face, len(s.variants))
+	for i, ft := range s.variants {
+		if ft != nil {
+			faces[i] = newFace(append([]*truetype.Font{ft}, s.fonts[1:]...), fontSize)
+		}
+	}
+	return faces[0], faces[1], faces[2]
+}
+
+// loadFontVariants loads the bold, italic and bold italic fonts of the
+// family of the font eg. 'Hack-Bold' for 'Hack-Regular'. The fonts not
+// found in your system are nil.
+func loadFontVariants(name string) (variants [3]*truetype.Font, err error) {
+	family := name
+	if i := strings.LastIndex(name, "-"); i > 0 {
+		family = name[:i]
+	}
+
+	for i, variant := range []string{"Bold", "Italic", "BoldItalic"} {
+		path, err := findfont.Find(family + "-" + variant + ".ttf")
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return variants, err
+		}
+		if variants[i], err = truetype.Parse(data); err != nil {
+			return variants, err
+		}
+	}
+	return variants, nil
+}
+
+// newFace returns font.Face of the fonts, which falls back to the following
+// fonts for the glyphs missing in the first one
+func newFace(fonts []*truetype.Font, fontSize float64) font.Face {
+	if len(fonts) == 1 {
+		return truetype.NewFace(fonts[0], &truetype.Options{Size: fontSize})
+	}
+
+	return germanium.NewFallbackFace(fontSize, fonts...)
 }
@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	flags "github.com/jessevdk/go-flags"
+)
+
+// projectConfigFile is the configuration file in the current directory
+const projectConfigFile = ".germanium.toml"
+
+// configPaths returns the paths of the configuration files in the order
+// they are applied: the user's one in $XDG_CONFIG_HOME, then the project's one
+func configPaths() []string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+
+	return []string{filepath.Join(dir, name, "config.toml"), projectConfigFile}
+}
+
+// configFiles returns the configuration files which exist
+func configFiles() []string {
+	var files []string
+	for _, path := range configPaths() {
+		if isFile(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// loadConfig merges the settings of the configuration files and the preset,
+// whose keys are the long names of the flags
+func loadConfig(files []string, preset string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	presets := make(map[string]interface{})
+	found := false
+
+	for _, path := range files {
+		var file map[string]interface{}
+		if _, err := toml.DecodeFile(path, &file); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		for k, v := range file {
+			if k != "preset" {
+				settings[k] = v
+				continue
+			}
+
+			sections, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid presets in %s", path)
+			}
+			if section, ok := sections[preset].(map[string]interface{}); ok && preset != "" {
+				found = true
+				for k, v := range section {
+					presets[k] = v
+				}
+			}
+		}
+	}
+
+	if preset != "" && !found {
+		return nil, fmt.Errorf("preset not found: %s", preset)
+	}
+
+	// the preset overrides the settings of every file
+	for k, v := range presets {
+		settings[k] = v
+	}
+
+	return settings, nil
+}
+
+// applyConfig sets the settings of the configuration files as the defaults
+// of the flags, so that the flags given in the command line override them
+func applyConfig(parser *flags.Parser, files []string, preset string) error {
+	settings, err := loadConfig(files, preset)
+	if err != nil {
+		return err
+	}
+
+	if err := applySettings(parser, settings, true); err != nil {
+		return fmt.Errorf("invalid configuration file: %w", err)
+	}
+	return nil
+}
+
+// applySettings sets the values of the flags of the long names, as their
+// defaults if asDefaults is true
+func applySettings(parser *flags.Parser, settings map[string]interface{}, asDefaults bool) error {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// pass the settings to the parser as ini
+	var ini strings.Builder
+	for _, k := range keys {
+		switch v := settings[k].(type) {
+		case string:
+			fmt.Fprintf(&ini, "%s = %s\n", k, strconv.Quote(v))
+		case bool, int64:
+			fmt.Fprintf(&ini, "%s = %v\n", k, v)
+		case float64:
+			// without the exponent, so that whole numbers are parsed as
+			// integers
+			fmt.Fprintf(&ini, "%s = %s\n", k, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("invalid value of %s: %v", k, v)
+		}
+	}
+
+	iniParser := flags.NewIniParser(parser)
+	iniParser.ParseAsDefaults = asDefaults
+	return iniParser.Parse(strings.NewReader(ini.String()))
+}
+
+// presetArg returns the value of --preset in the command line arguments,
+// which is needed before parsing them
+func presetArg(args []string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return ""
+		case arg == "--preset" && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(arg, "--preset="):
+			return strings.TrimPrefix(arg, "--preset=")
+		}
+	}
+	return ""
+}
+
+// printConfig prints the effective settings merged from the configuration
+// files, the preset and the flags in TOML
+func printConfig(w io.Writer, parser *flags.Parser, files []string, preset string) {
+	for _, path := range files {
+		fmt.Fprintf(w, "# %s\n", path)
+	}
+	if preset != "" {
+		fmt.Fprintf(w, "# preset: %s\n", preset)
+	}
+
+	for _, g := range parser.Groups() {
+		for _, opt := range g.Options() {
+			if opt.LongName == "" || opt.Field().Tag.Get("no-ini") != "" {
+				continue
+			}
+
+			v := reflect.ValueOf(opt.Value())
+			if s, ok := v.Interface().(fmt.Stringer); ok {
+				// durations are strings in TOML
+				fmt.Fprintf(w, "%s = %s\n", opt.LongName, strconv.Quote(s.String()))
+				continue
+			}
+			switch v.Kind() {
+			case reflect.Func:
+				// the help flag of the parser
+			case reflect.String:
+				fmt.Fprintf(w, "%s = %s\n", opt.LongName, strconv.Quote(v.String()))
+			default:
+				fmt.Fprintf(w, "%s = %v\n", opt.LongName, v.Interface())
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/matsuyoshi30/germanium"
+)
+
+// codeBlock is a fenced code block in Markdown
+type codeBlock struct {
+	// start and end are the indexes of the lines of the opening fence and
+	// the line following the closing fence
+	start, end int
+	language   string
+	attrs      map[string]string
+	source     string
+	output     string
+	err        error
+}
+
+// markdown renders the fenced code blocks of the Markdown file into the
+// output directory, and writes the Markdown with the blocks replaced by
+// the links to the images if opts.Rewrite is given
+func markdown(opts Options, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines, blocks, err := parseMarkdown(string(b))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(blocks) == 0 {
+		return fmt.Errorf("no code blocks in %s", path)
+	}
+
+	a, err := loadAssets(opts)
+	if err != nil {
+		return err
+	}
+	lexers := germanium.NewLexerCache()
+	format, err := outputFormat(opts)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range blocks {
+		block := &blocks[i]
+		block.output = filepath.Join(opts.OutDir, fmt.Sprintf("%s-%d.%s", name, i+1, format))
+		block.err = renderBlock(opts, block, a, lexers, format)
+		if block.err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", path, block.start+1, block.err)
+		}
+	}
+	fmt.Printf("rendered %d of %d code blocks into %s\n", len(blocks)-failed, len(blocks), opts.OutDir)
+
+	if opts.Rewrite != "" {
+		if err := rewriteMarkdown(opts.Rewrite, lines, blocks); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to render %d code blocks", failed)
+	}
+	return nil
+}
+
+// renderBlock renders the code block with its language and attributes
+func renderBlock(opts Options, block *codeBlock, a *assets, lexers *germanium.LexerCache, format string) error {
+	if block.language != "" {
+		opts.Language = block.language
+	}
+	for k, v := range block.attrs {
+		switch k {
+		case "title":
+			opts.Title = v
+		case "hl_lines":
+			opts.HighlightLines = strings.Join(strings.Fields(strings.ReplaceAll(v, ",", " ")), ",")
+		case "linenos":
+			opts.NoLineNum = v == "false"
+		case "linenostart":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid linenostart: %s", v)
+			}
+			opts.LineNumberStart = n
+		default:
+			return fmt.Errorf("unknown attribute: %s", k)
+		}
+	}
+
+	fontSize, err := parseFontSize(opts.FontSize)
+	if err != nil {
+		return err
+	}
+	renderOpts, err := renderOptions(opts, "", format, a, fontSize)
+	if err != nil {
+		return err
+	}
+	renderOpts = append(renderOpts,
+		germanium.WithLexerCache(lexers),
+	)
+
+	var src io.Reader = strings.NewReader(block.source)
+	if opts.RemoveExtraIndent {
+		src = removeExtraIndent(src)
+	}
+
+	return writeFile(block.output, func(w io.Writer) error {
+		return germanium.Render(context.Background(), w, src, renderOpts...)
+	})
+}
+
+// rewriteMarkdown writes the Markdown with the code blocks rendered
+// successfully replaced by the links to their images
+func rewriteMarkdown(path string, lines []string, blocks []codeBlock) error {
+	var b strings.Builder
+	i := 0
+	for _, block := range blocks {
+		if block.err != nil {
+			continue
+		}
+		for ; i < block.start; i++ {
+			b.WriteString(lines[i] + "\n")
+		}
+		i = block.end
+
+		link, err := filepath.Rel(filepath.Dir(path), block.output)
+		if err != nil {
+			return err
+		}
+		alt := block.attrs["title"]
+		if alt == "" {
+			alt = block.language
+		}
+		fmt.Fprintf(&b, "![%s](%s)\n", alt, filepath.ToSlash(link))
+	}
+	for ; i < len(lines); i++ {
+		b.WriteString(lines[i] + "\n")
+	}
+
+	return writeFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+}
+
+// parseMarkdown returns the lines of the Markdown and its fenced code
+// blocks, opened by ``` or ~~~ indented up to 3 spaces and closed by the
+// fence of the same character at least as long
+func parseMarkdown(src string) ([]string, []codeBlock, error) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+
+	var blocks []codeBlock
+	for i := 0; i < len(lines); i++ {
+		indent, fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+
+		language, attrs, err := parseInfo(info)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		block := codeBlock{start: i, end: len(lines), language: language, attrs: attrs}
+
+		var source []string
+		for j := i + 1; j < len(lines); j++ {
+			if closingFence(lines[j], fence) {
+				block.end = j + 1
+				break
+			}
+			// the indentation of the opening fence is removed from the lines
+			line := lines[j]
+			for k := 0; k < indent && strings.HasPrefix(line, " "); k++ {
+				line = line[1:]
+			}
+			source = append(source, line)
+		}
+		block.source = strings.Join(source, "\n")
+
+		blocks = append(blocks, block)
+		i = block.end - 1
+	}
+
+	return lines, blocks, nil
+}
+
+// openingFence returns the indentation, the fence and the info string of
+// the line if it opens a fenced code block
+func openingFence(line string) (int, string, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if indent > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return 0, "", "", false
+	}
+
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	if n < 3 {
+		return 0, "", "", false
+	}
+	fence, info := trimmed[:n], strings.TrimSpace(trimmed[n:])
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return 0, "", "", false
+	}
+	return indent, fence, info, true
+}
+
+// closingFence reports whether the line closes the block of the fence
+func closingFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// parseInfo parses the info string of a fenced code block into the
+// language and the attributes eg. 'go {title="main.go" hl_lines="2-4"}'
+func parseInfo(info string) (string, map[string]string, error) {
+	attrs := make(map[string]string)
+
+	var language string
+	if i := strings.Index(info, "{"); i >= 0 {
+		if !strings.HasSuffix(info, "}") {
+			return "", nil, fmt.Errorf("unclosed attributes: %s", info)
+		}
+		language = strings.TrimSpace(info[:i])
+
+		s := strings.TrimSpace(info[i+1 : len(info)-1])
+		for s != "" {
+			eq := strings.Index(s, "=")
+			if eq <= 0 {
+				return "", nil, fmt.Errorf("invalid attributes: %s", info)
+			}
+			key := strings.TrimSpace(s[:eq])
+			s = strings.TrimLeft(s[eq+1:], " ")
+
+			var value string
+			if strings.HasPrefix(s, `"`) {
+				end := strings.Index(s[1:], `"`)
+				if end < 0 {
+					return "", nil, fmt.Errorf("unclosed quote: %s", info)
+				}
+				value, s = s[1:end+1], s[end+2:]
+			} else {
+				end := strings.IndexAny(s, " ,")
+				if end < 0 {
+					end = len(s)
+				}
+				value, s = s[:end], s[end:]
+			}
+			attrs[key] = value
+			s = strings.TrimLeft(s, " ,")
+		}
+	} else {
+		language = info
+	}
+
+	// the words following the language are ignored eg. 'go main.go'
+	if fields := strings.Fields(language); len(fields) > 0 {
+		language = fields[0]
+	}
+
+	return language, attrs, nil
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInfo(t *testing.T) {
+	tests := []struct {
+		info     string
+		language string
+		attrs    map[string]string
+	}{
+		{info: "", language: "", attrs: map[string]string{}},
+		{info: "go", language: "go", attrs: map[string]string{}},
+		{info: "go main.go", language: "go", attrs: map[string]string{}},
+		{
+			info:     `go {title="main.go" hl_lines="2-4"}`,
+			language: "go",
+			attrs:    map[string]string{"title": "main.go", "hl_lines": "2-4"},
+		},
+		{
+			info:     `{linenos=false, linenostart=10}`,
+			language: "",
+			attrs:    map[string]string{"linenos": "false", "linenostart": "10"},
+		},
+		{
+			info:     `python {title="a = b, c"}`,
+			language: "python",
+			attrs:    map[string]string{"title": "a = b, c"},
+		},
+	}
+
+	for _, tt := range tests {
+		language, attrs, err := parseInfo(tt.info)
+		if err != nil {
+			t.Errorf("FAIL: %q: %v", tt.info, err)
+			continue
+		}
+		if language != tt.language || !reflect.DeepEqual(attrs, tt.attrs) {
+			t.Errorf("FAIL: %q: got %q %v, want %q %v", tt.info, language, attrs, tt.language, tt.attrs)
+		}
+	}
+
+	for _, info := range []string{`go {title="x"`, `go {title}`, `go {title="x}`} {
+		if _, _, err := parseInfo(info); err == nil {
+			t.Errorf("FAIL: no error for %q", info)
+		}
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	src := "# Title\n" +
+		"\n" +
+		"```go {title=\"main.go\"}\n" +
+		"package main\n" +
+		"```\n" +
+		"\n" +
+		"  ~~~~\n" +
+		"  ~~~\n" +
+		"    indented\n" +
+		"  ~~~~~\n" +
+		"````\n" +
+		"unclosed\n"
+
+	lines, blocks, err := parseMarkdown(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 12 {
+		t.Errorf("FAIL: %d lines", len(lines))
+	}
+
+	want := []codeBlock{
+		{start: 2, end: 5, language: "go", attrs: map[string]string{"title": "main.go"}, source: "package main"},
+		{start: 6, end: 10, language: "", attrs: map[string]string{}, source: "~~~\n  indented"},
+		{start: 10, end: 12, language: "", attrs: map[string]string{}, source: "unclosed"},
+	}
+	if !reflect.DeepEqual(blocks, want) {
+		t.Errorf("FAIL: got %+v, want %+v", blocks, want)
+	}
+}
@@ -1,17 +1,60 @@
 package cli
 
+import "time"
+
 type Options struct {
-	Output            string `short:"o" long:"output" default:"output.png" description:"Write output image to specific filepath"`
-	BackgroundColor   string `short:"b" long:"background" default:"#aaaaff" description:"Background color of the image"`
-	Font              string `short:"f" long:"font" default:"Hack-Regular" description:"Specify font eg. 'Hack-Bold'"`
-	Language          string `short:"l" long:"language" description:"The language for syntax highlighting"`
-	Style             string `short:"s" long:"style" description:"The style for syntax highlighting"`
-	Clipboard         bool   `short:"c" long:"clip" description:"Copy image to clipboard"`
-	ListStyles        bool   `long:"list-styles" description:"List all available styles for syntax highlighting"`
-	ListFonts         bool   `long:"list-fonts" description:"List all available fonts in your system"`
-	NoLineNum         bool   `long:"no-line-number" description:"Hide the line number"`
-	NoWindowAccessBar bool   `long:"no-window-access-bar" description:"Hide the window access bar"`
-	ShowVersion       bool   `short:"v" long:"version" description:"Show version"`
-	FontSize          string `long:"font-size" default:"24" description:"Specify size of font"`
-	RemoveExtraIndent bool   `long:"remove-extra-indent" description:"Remove extra indentation"`
+	Output              string        `short:"o" long:"output" default:"output.png" no-serve:"true" description:"Write output image to specific filepath, or - for stdout"`
+	BackgroundColor     string        `short:"b" long:"background" default:"#aaaaff" description:"Background color of the image, or transparent"`
+	BackgroundImage     string        `long:"background-image" no-serve:"true" description:"PNG or JPEG image drawn as the background"`
+	BackgroundImageMode string        `long:"background-image-mode" default:"cover" choice:"cover" choice:"contain" choice:"tile" description:"How the background image is scaled"`
+	BackgroundGradient  string        `long:"background-gradient" description:"Gradient drawn as the background eg. '#ff0000,#0000ff@45deg'"`
+	Font                string        `short:"f" long:"font" default:"Hack-Regular" no-serve:"true" description:"Specify font eg. 'Hack-Bold', or comma separated fallback fonts"`
+	Language            string        `short:"l" long:"language" description:"The language for syntax highlighting"`
+	Style               string        `short:"s" long:"style" description:"The style for syntax highlighting"`
+	Clipboard           bool          `short:"c" long:"clip" no-serve:"true" description:"Copy image to clipboard"`
+	Preset              string        `long:"preset" no-ini:"true" description:"Apply the named preset of the configuration file"`
+	OutDir              string        `long:"out-dir" default:"." no-serve:"true" description:"Directory of the output images in batch and markdown mode"`
+	Rewrite             string        `long:"rewrite" no-serve:"true" description:"Write the Markdown with the code blocks replaced by the image links in markdown mode"`
+	Jobs                int           `long:"jobs" no-serve:"true" description:"Number of files rendered at once in batch mode [default: number of CPUs]"`
+	Addr                string        `long:"addr" default:":8080" no-serve:"true" description:"Address listened by the rendering server"`
+	Watch               bool          `long:"watch" no-ini:"true" description:"Render again whenever the input file or the configuration files change"`
+	ListStyles          bool          `long:"list-styles" no-ini:"true" description:"List all available styles for syntax highlighting"`
+	ListFonts           bool          `long:"list-fonts" no-ini:"true" description:"List all available fonts in your system"`
+	NoLineNum           bool          `long:"no-line-number" description:"Hide the line number"`
+	NoWindowAccessBar   bool          `long:"no-window-access-bar" description:"Hide the window access bar"`
+	WindowStyle         string        `long:"window-style" default:"macos" choice:"macos" choice:"windows" choice:"gnome" choice:"minimal" choice:"none" description:"Look of the window chrome"`
+	CornerRadius        int           `long:"corner-radius" default:"10" description:"Radius of the corners of the window, 0 for square corners"`
+	Title               string        `long:"title" description:"Title in the window access bar"`
+	TitleFilename       bool          `long:"title-filename" description:"Show the input file name as the title"`
+	TitleColor          string        `long:"title-color" description:"Color of the title [default: contrast color of the window]"`
+	ShowVersion         bool          `short:"v" long:"version" no-ini:"true" description:"Show version"`
+	FontSize            string        `long:"font-size" default:"24" description:"Specify size of font"`
+	CharWidth           string        `long:"char-width" default:"glyph" choice:"glyph" choice:"cell" description:"How the width of the characters is measured"`
+	PaddingX            int           `long:"padding-x" default:"50" description:"Horizontal margin around the window"`
+	PaddingY            int           `long:"padding-y" default:"50" description:"Vertical margin around the window"`
+	InnerPadding        int           `long:"inner-padding" default:"10" description:"Space between the edge of the window and the text"`
+	LineSpacing         float64       `long:"line-spacing" default:"1.25" description:"Height of a line relative to the font size"`
+	Lines               string        `long:"lines" description:"Render only the line range eg. '40-75'"`
+	LineNumberStart     int           `long:"line-number-start" description:"Line number of the first rendered line"`
+	HighlightLines      string        `long:"highlight-lines" description:"Highlight the lines eg. '3,7-12'"`
+	HighlightColor      string        `long:"highlight-color" description:"Color of the highlighted line band [default: derived from style]"`
+	DimLines            bool          `long:"dim-lines" description:"Dim the lines which are not highlighted"`
+	Diff                bool          `long:"diff" description:"Render unified diff with the added and removed lines"`
+	ANSI                bool          `long:"ansi" description:"Render terminal output colored by ANSI escape sequences instead of highlighting"`
+	ANSIPalette         string        `long:"ansi-palette" default:"style" choice:"style" choice:"solarized" choice:"tango" choice:"vga" choice:"xterm" description:"Terminal colors of --ansi"`
+	RemoveExtraIndent   bool          `long:"remove-extra-indent" description:"Remove extra indentation"`
+	Format              string        `long:"format" description:"Output image format (png, svg, jpeg, gif, bmp or webp) [default: from output extension]"`
+	Quality             int           `long:"quality" default:"90" description:"Quality of JPEG images from 1 to 100"`
+	Animate             string        `long:"animate" choice:"typing" no-serve:"true" description:"Animate the source code being typed into GIF, or APNG for PNG output"`
+	CharsPerFrame       int           `long:"chars-per-frame" default:"1" description:"Number of the characters typed in a frame of the animation"`
+	FrameDelay          time.Duration `long:"frame-delay" default:"50ms" description:"Duration of a frame of the animation"`
+	Hold                time.Duration `long:"hold" default:"2s" description:"How long the whole source code is shown at the end of the animation"`
+	Cursor              bool          `long:"cursor" description:"Draw the cursor after the typed characters, blinking at the end of the animation"`
+	Scale               float64       `long:"scale" default:"1" description:"Multiply the size of the image for HiDPI displays eg. '2'"`
+	EmbedFont           bool          `long:"embed-font" description:"Embed the subset of the font used by the source code in SVG output"`
+	ShadowBlur          int           `long:"shadow-blur" description:"Blur radius of the window shadow"`
+	ShadowOffsetX       int           `long:"shadow-offset-x" description:"Horizontal offset of the window shadow"`
+	ShadowOffsetY       int           `long:"shadow-offset-y" description:"Vertical offset of the window shadow"`
+	ShadowSpread        int           `long:"shadow-spread" description:"Spread of the window shadow"`
+	ShadowColor         string        `long:"shadow-color" default:"#00000080" description:"Color of the window shadow"`
 }
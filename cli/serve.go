@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/matsuyoshi30/germanium"
+)
+
+const (
+	// maxRequestSize is the limit of the size of the request body
+	maxRequestSize = 1 << 20
+	// maxFontSize is the limit of the font size of a request
+	maxFontSize = 200
+	// maxScale is the limit of the scale of a request
+	maxScale = 4
+	// maxLineSpacing is the limit of the line spacing of a request
+	maxLineSpacing = 4
+	// maxPadding is the limit of the paddings and the corner radius of a
+	// request
+	maxPadding = 500
+	// maxShadow is the limit of the spread and the offsets of the shadow of
+	// a request
+	maxShadow = 200
+	// maxShadowBlur is the limit of the blur of the shadow of a request in
+	// pixels of the image, as the time to blur grows with it
+	maxShadowBlur = 100
+	// maxImagePixels is the limit of the size of the image of a request,
+	// checked before it is allocated
+	maxImagePixels = 1 << 22
+	// renderTimeout is the limit of the time to render a request
+	renderTimeout = 10 * time.Second
+)
+
+// server renders the source code of the requests with the options of the
+// request over the options of the command line. The fonts and the
+// background image are loaded once and each request has its own faces.
+type server struct {
+	opts   Options
+	assets *assets
+	lexers *germanium.LexerCache
+}
+
+// newServer returns the handler of the rendering server
+func newServer(opts Options) (http.Handler, error) {
+	a, err := loadAssets(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &server{opts: opts, assets: a, lexers: germanium.NewLexerCache()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", s.render)
+	mux.HandleFunc("/styles", s.styles)
+	mux.HandleFunc("/languages", s.languages)
+	return http.TimeoutHandler(mux, renderTimeout, "render timeout\n"), nil
+}
+
+// serve runs the rendering server until interrupted
+func serve(opts Options) error {
+	handler, err := newServer(opts)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       renderTimeout,
+		WriteTimeout:      2 * renderTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), renderTimeout)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	fmt.Printf("listening on %s\n", opts.Addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// render handles POST /render, whose body is the JSON object of the source
+// code and the options, keyed by the long names of the flags eg.
+// {"source": "package main", "language": "go", "font-size": 32}
+func (s *server) render(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxRequestSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(body, &settings); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	source, ok := settings["source"].(string)
+	if !ok {
+		http.Error(w, "source is required", http.StatusBadRequest)
+		return
+	}
+	delete(settings, "source")
+
+	opts, err := s.options(settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, err := outputFormat(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fontSize, err := parseFontSize(opts.FontSize)
+	if err != nil || fontSize <= 0 || fontSize > maxFontSize {
+		http.Error(w, fmt.Sprintf("invalid font size: %s", opts.FontSize), http.StatusBadRequest)
+		return
+	}
+
+	if opts.Scale <= 0 || opts.Scale > maxScale {
+		http.Error(w, fmt.Sprintf("invalid scale: %g", opts.Scale), http.StatusBadRequest)
+		return
+	}
+
+	if err := checkLimits(opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	renderOpts, err := renderOptions(opts, "", format, s.assets, fontSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	renderOpts = append(renderOpts,
+		germanium.WithLexerCache(s.lexers),
+		germanium.WithMaxPixels(maxImagePixels),
+	)
+
+	var src io.Reader = bytes.NewReader([]byte(source))
+	if opts.RemoveExtraIndent {
+		src = removeExtraIndent(src)
+	}
+
+	var out bytes.Buffer
+	if err := germanium.Render(r.Context(), &out, src, renderOpts...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "image/" + format
+	if format == germanium.FormatSVG {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(out.Bytes())
+}
+
+// options returns the options of the server overridden by the settings of
+// the request, which cannot set the options tagged with no-serve
+func (s *server) options(settings map[string]interface{}) (Options, error) {
+	opts := s.opts
+	parser := newParser(&opts)
+
+	for k := range settings {
+		opt := parser.FindOptionByLongName(k)
+		if opt == nil || opt.Field().Tag.Get("no-serve") != "" || opt.Field().Tag.Get("no-ini") != "" {
+			return opts, fmt.Errorf("unknown option: %s", k)
+		}
+	}
+
+	if err := applySettings(parser, settings, false); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// checkLimits reports an error if a setting sizing the image is out of the
+// range rendered by the server. The scale is checked before.
+func checkLimits(opts Options) error {
+	if opts.LineSpacing < 1 || opts.LineSpacing > maxLineSpacing {
+		return fmt.Errorf("invalid line spacing: %g (1 to %d)", opts.LineSpacing, maxLineSpacing)
+	}
+
+	limits := []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"padding-x", opts.PaddingX, 0, maxPadding},
+		{"padding-y", opts.PaddingY, 0, maxPadding},
+		{"inner-padding", opts.InnerPadding, 0, maxPadding},
+		{"corner-radius", opts.CornerRadius, 0, maxPadding},
+		{"shadow-blur", opts.ShadowBlur, 0, int(maxShadowBlur / opts.Scale)},
+		{"shadow-spread", opts.ShadowSpread, 0, maxShadow},
+		{"shadow-offset-x", opts.ShadowOffsetX, -maxShadow, maxShadow},
+		{"shadow-offset-y", opts.ShadowOffsetY, -maxShadow, maxShadow},
+	}
+	for _, l := range limits {
+		if l.value < l.min || l.value > l.max {
+			return fmt.Errorf("invalid %s: %d (%d to %d)", l.name, l.value, l.min, l.max)
+		}
+	}
+	return nil
+}
+
+// styles handles GET /styles, which returns the names of the styles
+func (s *server) styles(w http.ResponseWriter, r *http.Request) {
+	writeNames(w, r, styles.Names())
+}
+
+// languages handles GET /languages, which returns the names of the languages
+func (s *server) languages(w http.ResponseWriter, r *http.Request) {
+	writeNames(w, r, lexers.Names(false))
+}
+
+// writeNames writes the names in JSON
+func writeNames(w http.ResponseWriter, r *http.Request, names []string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
@@ -0,0 +1,242 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var opts Options
+	if _, err := newParser(&opts).ParseArgs(nil); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := newServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func postRender(t *testing.T, ts *httptest.Server, body interface{}) *http.Response {
+	t.Helper()
+
+	var b []byte
+	switch body := body.(type) {
+	case []byte:
+		b = body
+	default:
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/render", "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeRender(t *testing.T) {
+	ts := newTestServer(t)
+	testdata := filepath.Join("..", "cmd", "germanium", "testdata")
+	source, err := os.ReadFile(filepath.Join(testdata, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("png", func(t *testing.T) {
+		resp := postRender(t, ts, map[string]interface{}{"source": string(source), "language": "go"})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("FAIL: status %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+			t.Errorf("FAIL: content type %s", ct)
+		}
+		got, err := png.Decode(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(filepath.Join(testdata, "default.png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		want, err := png.Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(want.(*image.RGBA), got.(*image.RGBA)) {
+			t.Errorf("FAIL: output differs from default.png")
+		}
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		resp := postRender(t, ts, map[string]interface{}{
+			"source":         string(source),
+			"language":       "go",
+			"format":         "svg",
+			"font-size":      32,
+			"no-line-number": true,
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("FAIL: status %d", resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "image/svg+xml" {
+			t.Errorf("FAIL: content type %s", ct)
+		}
+	})
+}
+
+func TestServeRenderErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		desc    string
+		body    interface{}
+		status  int
+		message string
+	}{
+		{
+			desc:   "no source",
+			body:   map[string]interface{}{"language": "go"},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "invalid json",
+			body:   []byte("{"),
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "unknown option",
+			body:   map[string]interface{}{"source": "x", "unknown": true},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "output option",
+			body:   map[string]interface{}{"source": "x", "output": "/tmp/x.png"},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "font size",
+			body:   map[string]interface{}{"source": "x", "font-size": 1000},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "too large",
+			body:   map[string]interface{}{"source": strings.Repeat("x", maxRequestSize)},
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			desc:    "line spacing",
+			body:    map[string]interface{}{"source": "x", "line-spacing": 20000},
+			status:  http.StatusBadRequest,
+			message: "invalid line spacing",
+		},
+		{
+			desc:    "padding",
+			body:    map[string]interface{}{"source": "x", "padding-y": 3000000},
+			status:  http.StatusBadRequest,
+			message: "invalid padding-y: 3000000",
+		},
+		{
+			desc:    "shadow",
+			body:    map[string]interface{}{"source": "x", "shadow-blur": 100000},
+			status:  http.StatusBadRequest,
+			message: "invalid shadow-blur",
+		},
+		{
+			desc:   "empty background",
+			body:   map[string]interface{}{"source": "x", "background": ""},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "empty title color",
+			body:   map[string]interface{}{"source": "x", "title": "x", "title-color": "#"},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "empty highlight color",
+			body:   map[string]interface{}{"source": "x", "highlight-lines": "1", "highlight-color": "#"},
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:    "too many pixels",
+			body:    map[string]interface{}{"source": strings.Repeat("x\n", 100000)},
+			status:  http.StatusBadRequest,
+			message: "image is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			resp := postRender(t, ts, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Errorf("FAIL: status %d, want %d", resp.StatusCode, tt.status)
+			}
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tt.message) {
+				t.Errorf("FAIL: message %q, want %q", b, tt.message)
+			}
+		})
+	}
+
+	resp, err := http.Get(ts.URL + "/render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("FAIL: status %d for GET /render", resp.StatusCode)
+	}
+}
+
+func TestServeNames(t *testing.T) {
+	ts := newTestServer(t)
+
+	for path, want := range map[string]string{
+		"/styles":    "dracula",
+		"/languages": "Go",
+	} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		err = json.NewDecoder(resp.Body).Decode(&names)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("FAIL: decoding %s: %v", path, err)
+		}
+
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+		if !found {
+			t.Errorf("FAIL: %s not in %s", want, path)
+		}
+	}
+}
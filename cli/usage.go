@@ -1,20 +1,67 @@
 package cli
 
 const Usage = `USAGE:
-    %s [FLAGS] [FILE]
+    %s [FLAGS] [FILE[:START-END]]
+    %[1]s batch [FLAGS] PATTERN...
+    %[1]s markdown [FLAGS] FILE
+    %[1]s serve [FLAGS]
+    %[1]s config print
 
 FLAGS:
-    -o, --output <PATH>       Write output image to specific filepath [default: ./output.png]
-    -b, --background <COLOR>  Background color of the image [default: #aaaaff]
-    -f, --font <FONT>         Specify font eg. 'Hack-Bold'
+    -o, --output <PATH>       Write output image to specific filepath, or - for stdout [default: ./output.png]
+    -b, --background <COLOR>  Background color of the image, or transparent [default: #aaaaff]
+    --background-image <PATH> PNG or JPEG image drawn as the background
+    --background-image-mode <MODE>
+                              How the background image is scaled: cover, contain, tile [default: cover]
+    --background-gradient <GRADIENT>
+                              Gradient drawn as the background eg. '#ff0000,#0000ff@45deg', 'radial:#ffffff,#0000ff'
+    -f, --font <FONT>         Specify font eg. 'Hack-Bold', or comma separated fallback fonts
     -l, --language <LANG>     The language for syntax highlighting eg. 'go'
     -s, --style <STYLE>       The style for syntax highlighting eg. 'dracula'
     -c, --clip                Copy image to clipboard
+    --preset <NAME>           Apply the named preset of the configuration file
+    --out-dir <DIR>           Directory of the output images in batch and markdown mode [default: .]
+    --rewrite <PATH>          Write the Markdown with the code blocks replaced by the image links in markdown mode
+    --jobs <N>                Number of files rendered at once in batch mode [default: number of CPUs]
+    --watch                   Render again whenever the input file or the configuration files change
+    --addr <ADDR>             Address listened by the rendering server [default: :8080]
     --list-styles             List all available styles for syntax highlighting
     --list-fonts              List all available fonts in your system
+    --padding-x <PX>          Horizontal margin around the window [default: 50]
+    --padding-y <PX>          Vertical margin around the window [default: 50]
+    --inner-padding <PX>      Space between the edge of the window and the text [default: 10]
+    --line-spacing <N>        Height of a line relative to the font size [default: 1.25]
+    --char-width <MODE>       Width of the characters: glyph advances, or terminal cells where East Asian wide characters take two [default: glyph]
     --no-line-number          Hide the line number
     --no-window-access-bar    Hide the window access bar
+    --window-style <STYLE>    Look of the window chrome: macos, windows, gnome, minimal, none [default: macos]
+    --corner-radius <PX>      Radius of the corners of the window, 0 for square corners [default: 10]
+    --title <TEXT>            Title in the window access bar
+    --title-filename          Show the input file name as the title when --title is not given
+    --title-color <COLOR>     Color of the title [default: contrast color of the window]
+    --lines <START-END>       Render only the line range eg. '40-75'
+    --line-number-start <N>   Line number of the first rendered line [default: 1 or START]
+    --highlight-lines <LINES> Highlight the lines eg. '3,7-12'
+    --highlight-color <COLOR> Color of the highlighted line band [default: derived from style]
+    --dim-lines               Dim the lines which are not highlighted
+    --diff                    Render unified diff with the added and removed lines
+    --ansi                    Render terminal output colored by ANSI escape sequences instead of highlighting
+    --ansi-palette <PALETTE>  Terminal colors of --ansi: style, solarized, tango, vga, xterm [default: style]
     --remove-extra-indent     Remove extra indentation
+    --format <FORMAT>         Output image format: png, svg, jpeg, gif, bmp, webp [default: from output extension]
+    --quality <N>             Quality of JPEG images from 1 to 100 [default: 90]
+    --scale <N>               Multiply the size of the image for HiDPI displays eg. '2' [default: 1]
+    --animate <MODE>          Animate the source code being typed into GIF, or APNG for PNG output: typing
+    --chars-per-frame <N>     Number of the characters typed in a frame of the animation [default: 1]
+    --frame-delay <DURATION>  Duration of a frame of the animation [default: 50ms]
+    --hold <DURATION>         How long the whole source code is shown at the end of the animation [default: 2s]
+    --cursor                  Draw the cursor after the typed characters, blinking at the end of the animation
+    --embed-font              Embed the glyphs used by the source code in SVG output
+    --shadow-blur <PX>        Blur radius of the window shadow [default: 0]
+    --shadow-offset-x <PX>    Horizontal offset of the window shadow [default: 0]
+    --shadow-offset-y <PX>    Vertical offset of the window shadow [default: 0]
+    --shadow-spread <PX>      Spread of the window shadow [default: 0]
+    --shadow-color <COLOR>    Color of the window shadow [default: #00000080]
     -v, --version             Show Version
 
 AUTHOR:
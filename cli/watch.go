@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// pollInterval is the interval of checking the watched files for changes
+const pollInterval = 250 * time.Millisecond
+
+// fileState is the state of a watched file, which changes when the file is
+// written, created or removed
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+// statFiles returns the states of the files
+func statFiles(paths []string) []fileState {
+	states := make([]fileState, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[i] = fileState{exists: true, size: info.Size(), modTime: info.ModTime().UnixNano()}
+		}
+	}
+	return states
+}
+
+// watch renders, and renders again whenever the files change until
+// interrupted. The errors are reported without stopping watching.
+func watch(paths []string, render func() error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rerender := func() {
+		if err := render(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		fmt.Printf("%s rendered\n", time.Now().Format("15:04:05"))
+	}
+
+	states := statFiles(paths)
+	rerender()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := statFiles(paths)
+		changed := false
+		for i := range states {
+			changed = changed || current[i] != states[i]
+		}
+		if changed {
+			states = current
+			rerender()
+		}
+	}
+}
+
+// reloadOptions parses the configuration files and the command line
+// arguments again
+func reloadOptions(preset string) (Options, error) {
+	var opts Options
+	parser := newParser(&opts)
+	if err := applyConfig(parser, configFiles(), preset); err != nil {
+		return opts, err
+	}
+	_, err := parser.Parse()
+	return opts, err
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"image"
+	"image/gif"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 var genGoldenFiles = flag.Bool("gen_golden_files", false, "whether to generate the golden files fot test")
@@ -54,16 +60,154 @@ func TestMain(t *testing.T) {
 			args: []string{"--no-window-access-bar"},
 			file: "main.go",
 		},
+		{
+			desc: "window-style-windows",
+			args: []string{"--window-style", "windows", "--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "window-style-gnome",
+			args: []string{"--window-style", "gnome", "--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "window-style-minimal",
+			args: []string{"--window-style", "minimal", "--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "window-style-none",
+			args: []string{"--window-style", "none", "--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "corner-radius",
+			args: []string{"--corner-radius", "20", "--shadow-blur", "20", "--shadow-spread", "4"},
+			file: "main.go",
+		},
+		{
+			desc: "corner-radius-zero",
+			args: []string{"--corner-radius", "0", "--window-style", "windows"},
+			file: "main.go",
+		},
+		{
+			desc: "padding",
+			args: []string{"--padding-x", "20", "--padding-y", "30", "--inner-padding", "25", "--line-spacing", "1.6", "--highlight-lines", "4"},
+			file: "main.go",
+		},
 		{
 			desc: "style",
 			args: []string{"-s", "solarized-dark"},
 			file: "main.go",
 		},
+		{
+			desc: "shadow",
+			args: []string{"--shadow-blur", "20", "--shadow-offset-x", "-10", "--shadow-offset-y", "30", "--shadow-color", "#000000aa"},
+			file: "main.go",
+		},
+		{
+			desc: "background-gradient",
+			args: []string{"--background-gradient", "#ff0000,#ffff00 30%,#0000ff@45deg"},
+			file: "main.go",
+		},
+		{
+			desc: "background-radial-gradient",
+			args: []string{"--background-gradient", "radial:#ffffff,#aaaaff"},
+			file: "main.go",
+		},
+		{
+			desc: "background-transparent",
+			args: []string{"-b", "transparent", "--shadow-blur", "20", "--shadow-offset-y", "10"},
+			file: "main.go",
+		},
+		{
+			desc: "background-translucent",
+			args: []string{"-b", "#aaaaff80", "--background-gradient", "#ff000000,#0000ff80"},
+			file: "main.go",
+		},
+		{
+			desc: "background-image",
+			args: []string{"--background-image", filepath.Join("testdata", "light-style.png"), "--background-image-mode", "contain"},
+			file: "main.go",
+		},
+		{
+			desc: "title",
+			args: []string{"--title", "Hello, World", "--title-color", "#ff79c6"},
+			file: "main.go",
+		},
+		{
+			desc: "title-filename",
+			args: []string{"--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "highlight-lines",
+			args: []string{"--highlight-lines", "3,7-8", "--dim-lines"},
+			file: "main.go",
+		},
+		{
+			desc: "highlight-lines-no-line-num",
+			args: []string{"--highlight-lines", "8", "--highlight-color", "#ffffff30", "--no-line-number"},
+			file: "main.go",
+		},
+		{
+			desc: "line-range",
+			file: "multiline.go:6-10",
+		},
+		{
+			desc: "line-range-flag",
+			args: []string{"--lines", "9-15", "--highlight-lines", "10"},
+			file: "multiline.go",
+		},
+		{
+			desc: "line-number-start",
+			args: []string{"--line-number-start", "98"},
+			file: "main.go",
+		},
+		{
+			desc: "diff",
+			args: []string{"--diff"},
+			file: "main.diff",
+		},
+		{
+			desc: "diff-no-line-num",
+			args: []string{"--diff", "--no-line-number"},
+			file: "main.diff",
+		},
+		{
+			desc: "ansi",
+			args: []string{"--ansi"},
+			file: "ansi.txt",
+		},
+		{
+			desc: "ansi-palette",
+			args: []string{"--ansi", "--ansi-palette", "xterm", "-s", "solarized-dark"},
+			file: "ansi.txt",
+		},
+		{
+			desc: "font-fallback",
+			args: []string{"--font", "Hack-Regular," + filepath.Join("testdata", "Go-Mono.ttf")},
+			file: "symbols.go",
+		},
+		{
+			desc: "wide-glyph",
+			file: "wide.go",
+		},
+		{
+			desc: "wide-cell",
+			args: []string{"--char-width", "cell"},
+			file: "wide.go",
+		},
 		{
 			desc: "remove-extra-indentation",
 			args: []string{"--remove-extra-indent"},
 			file: "main-extra-indent.go",
 		},
+		{
+			desc: "scale",
+			args: []string{"--scale", "2", "--title-filename", "--shadow-blur", "20", "--shadow-offset-y", "10"},
+			file: "main.go",
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,7 +250,7 @@ func TestMain(t *testing.T) {
 				t.Errorf("FAIL: decoding got file: %s\n", tt.desc)
 			}
 
-			if !reflect.DeepEqual(wantImg.(*image.RGBA), gotImg.(*image.RGBA)) {
+			if !reflect.DeepEqual(wantImg, gotImg) {
 				t.Errorf("FAIL: output differs: %s\n", tt.desc)
 			}
 
@@ -118,3 +262,513 @@ func TestMain(t *testing.T) {
 		})
 	}
 }
+
+func TestSVG(t *testing.T) {
+	defaultArg := []string{"germanium", "-l", "go"}
+
+	tests := []struct {
+		desc string
+		args []string
+		file string
+	}{
+		{
+			desc: "svg",
+			file: "main.go",
+		},
+		{
+			desc: "svg-only-editor",
+			args: []string{"--no-line-number", "--no-window-access-bar"},
+			file: "main.go",
+		},
+		{
+			desc: "svg-title",
+			args: []string{"--title-filename"},
+			file: "main.go",
+		},
+		{
+			desc: "svg-window-style",
+			args: []string{"--window-style", "windows", "--title", "main.go"},
+			file: "main.go",
+		},
+		{
+			desc: "svg-embed-font",
+			args: []string{"--embed-font"},
+			file: "multibytes.go",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			genfile := tt.desc + "-gen.svg"
+			os.Args = append(defaultArg, filepath.Join("testdata", tt.file))
+			os.Args = append(os.Args, append(tt.args, "-o", genfile)...)
+			exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+			main()
+
+			if *genGoldenFiles {
+				if err := os.Rename(genfile, filepath.Join("testdata", tt.desc+".svg")); err != nil {
+					t.Errorf("FAIL: %v\n", err)
+				}
+				t.Logf("Generate file: %s\n", tt.desc+".svg")
+				return
+			}
+
+			want, err := os.ReadFile(filepath.Join("testdata", tt.desc+".svg"))
+			if err != nil {
+				t.Errorf("FAIL: reading want file: %s\n", tt.desc)
+			}
+			got, err := os.ReadFile(genfile)
+			if err != nil {
+				t.Errorf("FAIL: reading got file: %s\n", tt.desc)
+			}
+
+			if !bytes.Equal(want, got) {
+				t.Errorf("FAIL: output differs: %s\n", tt.desc)
+			}
+
+			if err := os.Remove(genfile); err != nil {
+				t.Errorf("FAIL: cleanup got file: %s\n", tt.desc)
+			}
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	xdg, ok := os.LookupEnv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join("testdata", "config"))
+	defer func() {
+		if ok {
+			os.Setenv("XDG_CONFIG_HOME", xdg)
+		} else {
+			os.Unsetenv("XDG_CONFIG_HOME")
+		}
+	}()
+	exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+	t.Run("preset", func(t *testing.T) {
+		genfile := "preset-gen.png"
+		os.Args = []string{"germanium", "-l", "go", filepath.Join("testdata", "main.go"), "--preset", "slides", "--window-style", "gnome", "-o", genfile}
+
+		main()
+
+		if *genGoldenFiles {
+			if err := os.Rename(genfile, filepath.Join("testdata", "preset.png")); err != nil {
+				t.Errorf("FAIL: %v\n", err)
+			}
+			t.Logf("Generate file: %s\n", "preset.png")
+			return
+		}
+		defer os.Remove(genfile)
+
+		want, err := os.ReadFile(filepath.Join("testdata", "preset.png"))
+		if err != nil {
+			t.Fatalf("FAIL: reading want file: %v\n", err)
+		}
+		wantImg, err := png.Decode(bytes.NewReader(want))
+		if err != nil {
+			t.Fatalf("FAIL: decoding want file: %v\n", err)
+		}
+		got, err := os.ReadFile(genfile)
+		if err != nil {
+			t.Fatalf("FAIL: reading got file: %v\n", err)
+		}
+		gotImg, err := png.Decode(bytes.NewReader(got))
+		if err != nil {
+			t.Fatalf("FAIL: decoding got file: %v\n", err)
+		}
+
+		if !reflect.DeepEqual(wantImg.(*image.RGBA), gotImg.(*image.RGBA)) {
+			t.Errorf("FAIL: output differs: preset\n")
+		}
+	})
+
+	t.Run("print", func(t *testing.T) {
+		os.Args = []string{"germanium", "config", "print", "--preset", "slides", "--window-style", "gnome"}
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		main()
+		os.Stdout = stdout
+		w.Close()
+
+		var out bytes.Buffer
+		if _, err := out.ReadFrom(r); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range []string{
+			`style = "autumn"`,
+			`padding-x = 30`,
+			`font-size = "48"`,
+			`no-line-number = true`,
+			`window-style = "gnome"`,
+		} {
+			if !bytes.Contains(out.Bytes(), []byte(want+"\n")) {
+				t.Errorf("FAIL: %q not in output:\n%s", want, out.String())
+			}
+		}
+	})
+
+	t.Run("unknown preset", func(t *testing.T) {
+		os.Args = []string{"germanium", "config", "print", "--preset", "unknown"}
+		code := 0
+		exit = func(c int) { code = c }
+		main()
+		if code == 0 {
+			t.Errorf("FAIL: no error for unknown preset")
+		}
+	})
+}
+
+func TestBatch(t *testing.T) {
+	decode := func(path string) *image.RGBA {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("FAIL: %v\n", err)
+		}
+		defer f.Close()
+		img, err := png.Decode(f)
+		if err != nil {
+			t.Fatalf("FAIL: decoding %s: %v\n", path, err)
+		}
+		return img.(*image.RGBA)
+	}
+
+	t.Run("glob", func(t *testing.T) {
+		outDir := t.TempDir()
+		os.Args = []string{"germanium", "batch", "testdata/batch/**/*.go", "-l", "go", "--out-dir", outDir, "--jobs", "2"}
+		exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+		main()
+
+		want := decode(filepath.Join("testdata", "default.png"))
+		for _, out := range []string{"main.png", filepath.Join("sub", "main.png")} {
+			if !reflect.DeepEqual(want, decode(filepath.Join(outDir, out))) {
+				t.Errorf("FAIL: output differs: %s\n", out)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		outDir := t.TempDir()
+		// only multiline.go has the lines
+		os.Args = []string{"germanium", "batch", "testdata/*.go", "-l", "go", "--out-dir", outDir, "--lines", "11-12"}
+		code := 0
+		exit = func(c int) { code = c }
+
+		main()
+
+		if code != 1 {
+			t.Errorf("FAIL: exit %d for the failed files\n", code)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "multiline.png")); err != nil {
+			t.Errorf("FAIL: %v\n", err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, "main.png")); !os.IsNotExist(err) {
+			t.Errorf("FAIL: main.png is written: %v\n", err)
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		inDir, outDir := t.TempDir(), t.TempDir()
+		src, err := os.ReadFile(filepath.Join("testdata", "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// x.go and x.py are both rendered into x.png
+		if err := os.WriteFile(filepath.Join(inDir, "x.go"), src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(inDir, "x.py"), []byte("print(1)\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Args = []string{"germanium", "batch", filepath.Join(inDir, "*"), "-l", "go", "--out-dir", outDir}
+		code := 0
+		exit = func(c int) { code = c }
+
+		main()
+
+		if code != 1 {
+			t.Errorf("FAIL: exit %d for the output written by two files\n", code)
+		}
+		if !reflect.DeepEqual(decode(filepath.Join("testdata", "default.png")), decode(filepath.Join(outDir, "x.png"))) {
+			t.Errorf("FAIL: x.png is overwritten by x.py\n")
+		}
+	})
+}
+
+func TestSubcommandFile(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "default.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// the file named serve is rendered instead of starting the server
+	if err := os.WriteFile("serve", src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Args = []string{"germanium", "serve", "-l", "go", "-o", "serve.png"}
+	exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+	main()
+
+	got, err := os.ReadFile("serve.png")
+	if err != nil {
+		t.Fatalf("FAIL: %v\n", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Errorf("FAIL: output differs\n")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupt is not supported on windows")
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "main.go")
+	output := filepath.Join(dir, "main.png")
+	copyFile := func(src string) {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join("testdata", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(input, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// waitOutput waits for the output to be written differently from prev
+	waitOutput := func(prev []byte) []byte {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if b, err := os.ReadFile(output); err == nil && !bytes.Equal(b, prev) {
+				return b
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatal("FAIL: output is not written")
+		return nil
+	}
+
+	copyFile("main.go")
+	os.Args = []string{"germanium", "-l", "go", input, "-o", output, "--watch"}
+	exit = func(code int) { t.Errorf("exit %d during main", code) }
+	done := make(chan struct{})
+	go func() {
+		main()
+		close(done)
+	}()
+
+	first := waitOutput(nil)
+	want, err := os.ReadFile(filepath.Join("testdata", "default.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantImg, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotImg, err := png.Decode(bytes.NewReader(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantImg.(*image.RGBA), gotImg.(*image.RGBA)) {
+		t.Errorf("FAIL: output differs: watch\n")
+	}
+
+	copyFile("multiline.go")
+	if _, err := png.Decode(bytes.NewReader(waitOutput(first))); err != nil {
+		t.Errorf("FAIL: decoding output written again: %v\n", err)
+	}
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FAIL: watch is not stopped by interrupt")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	outDir := t.TempDir()
+	rewrite := filepath.Join(outDir, "README.md")
+	os.Args = []string{"germanium", "markdown", filepath.Join("testdata", "markdown", "README.md"), "--out-dir", filepath.Join(outDir, "img"), "--rewrite", rewrite, "--title-color", "#ff79c6"}
+	exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+	main()
+
+	for out, golden := range map[string]string{
+		"README-1.png": "title.png",
+		"README-2.png": "no-line-num.png",
+	} {
+		want, err := os.ReadFile(filepath.Join("testdata", golden))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantImg, err := png.Decode(bytes.NewReader(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(outDir, "img", out))
+		if err != nil {
+			t.Fatalf("FAIL: reading got file: %v\n", err)
+		}
+		gotImg, err := png.Decode(bytes.NewReader(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(wantImg.(*image.RGBA), gotImg.(*image.RGBA)) {
+			t.Errorf("FAIL: output differs: %s\n", out)
+		}
+	}
+
+	got, err := os.ReadFile(rewrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Example\n\nThe program prints a message.\n\n![Hello, World](img/README-1.png)\n\nWithout line numbers:\n\n![go](img/README-2.png)\n"
+	if string(got) != want {
+		t.Errorf("FAIL: rewritten markdown:\n%s", got)
+	}
+}
+
+func TestStdout(t *testing.T) {
+	tests := []struct {
+		desc   string
+		args   []string
+		decode func(io.Reader) (image.Image, error)
+	}{
+		{desc: "png", decode: png.Decode},
+		{desc: "jpeg", args: []string{"--format", "jpg", "--quality", "80"}, decode: jpeg.Decode},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.desc, func(t *testing.T) {
+			os.Args = append([]string{"germanium", "-l", "go", filepath.Join("testdata", "main.go"), "-o", "-"}, tt.args...)
+			exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := make(chan []byte)
+			go func() {
+				b, _ := io.ReadAll(r)
+				out <- b
+			}()
+			stdout := os.Stdout
+			os.Stdout = w
+			main()
+			os.Stdout = stdout
+			w.Close()
+			got := <-out
+
+			gotImg, err := tt.decode(bytes.NewReader(got))
+			if err != nil {
+				t.Fatalf("FAIL: decoding stdout: %v\n", err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", "default.png"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantImg, err := png.Decode(bytes.NewReader(want))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gotImg.Bounds() != wantImg.Bounds() {
+				t.Errorf("FAIL: bounds = %v, want %v\n", gotImg.Bounds(), wantImg.Bounds())
+			}
+			if tt.desc == "png" && !reflect.DeepEqual(wantImg.(*image.RGBA), gotImg.(*image.RGBA)) {
+				t.Errorf("FAIL: output differs: stdout\n")
+			}
+		})
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	genfile := "unsupported-gen.xyz"
+	os.Args = []string{"germanium", "-l", "go", filepath.Join("testdata", "main.go"), "-o", genfile}
+	code := 0
+	exit = func(c int) { code = c }
+
+	main()
+
+	if code == 0 {
+		t.Errorf("FAIL: no error for unsupported extension")
+	}
+	if _, err := os.Stat(genfile); !os.IsNotExist(err) {
+		os.Remove(genfile)
+		t.Errorf("FAIL: %s is written", genfile)
+	}
+}
+
+func TestAnimate(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "main.gif")
+	os.Args = []string{"germanium", "-l", "go", filepath.Join("testdata", "main.go"), "-o", output,
+		"--animate", "typing", "--chars-per-frame", "4", "--frame-delay", "30ms", "--hold", "1s", "--cursor"}
+	exit = func(code int) { t.Fatalf("exit %d during main", code) }
+
+	main()
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("FAIL: decoding animation: %v\n", err)
+	}
+
+	want, err := os.Open(filepath.Join("testdata", "default.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer want.Close()
+	wantImg, err := png.Decode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := image.Rect(0, 0, g.Config.Width, g.Config.Height); b != wantImg.Bounds() {
+		t.Errorf("FAIL: bounds = %v, want %v\n", b, wantImg.Bounds())
+	}
+	if len(g.Image) < 10 {
+		t.Errorf("FAIL: %d frames\n", len(g.Image))
+	}
+	if g.Delay[0] != 3 {
+		t.Errorf("FAIL: delay = %d, want 3\n", g.Delay[0])
+	}
+}
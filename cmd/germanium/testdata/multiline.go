@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+/*
+   A comment spanning
+   several lines
+*/
+const usage = `usage:
+    germanium [FILE]
+`
+
+func main() {
+	fmt.Print(usage)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	// ☺ ♥ ♠ ♣ ♦ are not in Hack
+	fmt.Println("I ♥ Go ☺")
+}
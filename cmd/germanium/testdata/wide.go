@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	// 日本語のコメント
+	fmt.Println("café naïve") // combining marks
+	fmt.Println("👨‍👩‍👧 👍🏽") // emoji ZWJ sequence
+	fmt.Println("ｱｲｳ ＡＢＣ") // half and full width
+}
@@ -0,0 +1,240 @@
+package germanium
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DiffKind is the kind of a line of unified diff
+type DiffKind int
+
+// diff line kinds
+const (
+	DiffContext DiffKind = iota
+	DiffAdded
+	DiffRemoved
+	DiffHunk
+)
+
+var (
+	// line background colors
+	diffAddedBackground   = color.NRGBA{46, 160, 67, 64}
+	diffRemovedBackground = color.NRGBA{248, 81, 73, 64}
+
+	// gutter marker colors
+	diffAddedMarker   = color.RGBA{63, 185, 80, 255}
+	diffRemovedMarker = color.RGBA{248, 81, 73, 255}
+)
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// DiffLine is a line of unified diff
+type DiffLine struct {
+	Kind DiffKind
+	// Old and New are the line numbers in the old and new file, 0 if the
+	// line does not exist in the file
+	Old int
+	New int
+	// Text is the source code without the marker, or the header of a hunk
+	Text string
+}
+
+// Diff is a parsed unified diff
+type Diff struct {
+	Lines []DiffLine
+	// Filename is the name of the new file, used to choose the lexer
+	Filename string
+}
+
+// ParseDiff parses unified diff such as the output of 'git diff'. The diff
+// of more than one file is rejected, since the lines are lexed as a single
+// source code in the language of the file.
+func ParseDiff(r io.Reader) (*Diff, error) {
+	d := &Diff{}
+	files := 0
+
+	// line numbers and the numbers of lines left in the current hunk
+	var old, new, oldLeft, newLeft int
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if oldLeft <= 0 && newLeft <= 0 {
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				old, oldLeft = hunkRange(m[1], m[2])
+				new, newLeft = hunkRange(m[3], m[4])
+				d.Lines = append(d.Lines, DiffLine{Kind: DiffHunk, Text: line})
+			} else if strings.HasPrefix(line, "+++ ") {
+				if files++; files > 1 {
+					return nil, fmt.Errorf("diff of more than one file: %s", strings.TrimPrefix(line, "+++ "))
+				}
+				name := strings.Fields(strings.TrimPrefix(line, "+++ "))
+				if len(name) > 0 && name[0] != "/dev/null" {
+					d.Filename = strings.TrimPrefix(name[0], "b/")
+				}
+			}
+			continue
+		}
+
+		switch {
+		case line == "" || line[0] == ' ':
+			d.Lines = append(d.Lines, DiffLine{Kind: DiffContext, Old: old, New: new, Text: trimMarker(line)})
+			old++
+			new++
+			oldLeft--
+			newLeft--
+		case line[0] == '+':
+			d.Lines = append(d.Lines, DiffLine{Kind: DiffAdded, New: new, Text: line[1:]})
+			new++
+			newLeft--
+		case line[0] == '-':
+			d.Lines = append(d.Lines, DiffLine{Kind: DiffRemoved, Old: old, Text: line[1:]})
+			old++
+			oldLeft--
+		case line[0] == '\\':
+			// \ No newline at end of file
+		default:
+			return nil, fmt.Errorf("invalid line in hunk: %s", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(d.Lines) == 0 {
+		return nil, fmt.Errorf("no hunk found in diff")
+	}
+
+	return d, nil
+}
+
+// hunkRange returns the start line and the number of lines of a hunk range
+func hunkRange(start, count string) (int, int) {
+	s, _ := strconv.Atoi(start)
+	if count == "" {
+		return s, 1
+	}
+	c, _ := strconv.Atoi(count)
+	return s, c
+}
+
+func trimMarker(line string) string {
+	if line == "" {
+		return line
+	}
+	return line[1:]
+}
+
+// Source returns the source code of the diff to lex, where the hunk headers
+// are empty lines
+func (d *Diff) Source() string {
+	var b strings.Builder
+	for _, l := range d.Lines {
+		if l.Kind != DiffHunk {
+			b.WriteString(l.Text)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// digits returns the number of digits of the largest line number
+func (d *Diff) digits() int {
+	max := 0
+	for _, l := range d.Lines {
+		if l.Old > max {
+			max = l.Old
+		}
+		if l.New > max {
+			max = l.New
+		}
+	}
+	return len(strconv.Itoa(max))
+}
+
+// gutterWidth returns the width of the gutter in characters
+func (d *Diff) gutterWidth(hasLineNum bool) int {
+	if hasLineNum {
+		// old and new line numbers, then the marker
+		return (d.digits()+1)*2 + 2
+	}
+	return 2
+}
+
+// gutter returns the line numbers and the marker of the line
+func (d *Diff) gutter(i int, hasLineNum bool) (numbers string, marker string) {
+	l := d.Lines[i]
+
+	switch l.Kind {
+	case DiffAdded:
+		marker = "+"
+	case DiffRemoved:
+		marker = "-"
+	case DiffHunk:
+		marker = ""
+	default:
+		marker = " "
+	}
+
+	if !hasLineNum || l.Kind == DiffHunk {
+		return "", marker
+	}
+
+	number := func(n int) string {
+		if n == 0 {
+			return strings.Repeat(" ", d.digits()+1)
+		}
+		return fmt.Sprintf("%*d", d.digits()+1, n)
+	}
+	return number(l.Old) + number(l.New) + " ", marker
+}
+
+// background returns the background color of the line and whether it has one
+func (d *Diff) background(i int) (color.NRGBA, bool) {
+	switch d.Lines[i].Kind {
+	case DiffAdded:
+		return diffAddedBackground, true
+	case DiffRemoved:
+		return diffRemovedBackground, true
+	}
+	return color.NRGBA{}, false
+}
+
+// markerColor returns the color of the marker of the line, where fg is the
+// color of the context lines
+func (d *Diff) markerColor(i int, fg color.Color) color.Color {
+	switch d.Lines[i].Kind {
+	case DiffAdded:
+		return diffAddedMarker
+	case DiffRemoved:
+		return diffRemovedMarker
+	}
+	return fg
+}
+
+// SetDiff renders the source code as the diff, with the old and new line
+// numbers and the markers in the gutter. The source code passed to NewImage
+// and Label must be Diff.Source().
+func (p *Panel) SetDiff(d *Diff) {
+	p.diff = d
+
+	p.lines = make([]string, len(d.Lines))
+	for i, l := range d.Lines {
+		p.lines[i] = l.Text
+	}
+	p.lineRange = LineRange{Start: 1, End: len(d.Lines)}
+}
+
+// lineBand returns the rectangle from left to right behind the line whose
+// baseline is at y
+func lineBand(left, right, y, ascent, descent, lineHeight int) image.Rectangle {
+	top := y - (ascent-descent+lineHeight)/2
+	return image.Rect(left, top, right, top+lineHeight)
+}
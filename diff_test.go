@@ -0,0 +1,39 @@
+package germanium
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	single := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+-var a = 1
++var a = 2
+`
+	d, err := ParseDiff(strings.NewReader(single))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Filename != "main.go" {
+		t.Errorf("filename = %q, want main.go", d.Filename)
+	}
+	if len(d.Lines) != 4 {
+		t.Errorf("%d lines, want 4", len(d.Lines))
+	}
+
+	// the second file would be lexed in the language of the first one
+	multiple := single + `diff --git a/style.css b/style.css
+--- a/style.css
++++ b/style.css
+@@ -1 +1 @@
+-a { color: red; }
++a { color: blue; }
+`
+	if _, err := ParseDiff(strings.NewReader(multiple)); err == nil {
+		t.Errorf("diff of two files is accepted")
+	}
+}
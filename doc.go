@@ -0,0 +1,6 @@
+// Package germanium generates images of source code.
+//
+// A Panel holds the whole state of a render, so that the images can be
+// generated in parallel goroutines. A font.Face is not safe for concurrent
+// use, so each Panel needs its own face.
+package germanium
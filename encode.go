@@ -0,0 +1,107 @@
+package germanium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/bmp"
+)
+
+// raster image formats besides FormatPNG, drawn on the same image.RGBA and
+// encoded differently
+const (
+	FormatJPEG = "jpeg"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatWebP = "webp"
+)
+
+// DefaultJPEGQuality is the quality of JPEG images by default
+const DefaultJPEGQuality = 90
+
+// baseDPI is the resolution of the images at the scale 1
+const baseDPI = 72
+
+// isRaster reports whether the format is a raster image format
+func isRaster(format string) bool {
+	switch format {
+	case FormatPNG, FormatJPEG, FormatGIF, FormatBMP, FormatWebP:
+		return true
+	}
+	return false
+}
+
+// Encoder returns the function encoding the image in the raster format.
+// quality is the quality of JPEG images from 1 to 100.
+func Encoder(format string, quality int) (func(io.Writer, image.Image) error, error) {
+	switch format {
+	case FormatPNG:
+		return png.Encode, nil
+	case FormatJPEG:
+		if quality < 1 || quality > 100 {
+			return nil, fmt.Errorf("invalid JPEG quality: %d", quality)
+		}
+		return func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+		}, nil
+	case FormatGIF:
+		return func(w io.Writer, img image.Image) error {
+			return gif.Encode(w, img, &gif.Options{NumColors: 256, Quantizer: medianCut{}})
+		}, nil
+	case FormatBMP:
+		return bmp.Encode, nil
+	case FormatWebP:
+		return encodeWebP, nil
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// pngEncoder returns the function encoding PNG with the pHYs chunk of the
+// resolution, so that the image is displayed at its size divided by the
+// resolution over baseDPI
+func pngEncoder(dpi float64) func(io.Writer, image.Image) error {
+	return func(w io.Writer, img image.Image) error {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+
+		// the chunk follows the signature and the IHDR chunk
+		const ihdrEnd = 8 + 4 + 4 + 13 + 4
+		b := buf.Bytes()
+		for _, part := range [][]byte{b[:ihdrEnd], physChunk(dpi), b[ihdrEnd:]} {
+			if _, err := w.Write(part); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// physChunk returns the PNG pHYs chunk of the resolution
+func physChunk(dpi float64) []byte {
+	// pixels per meter in both axes
+	ppm := uint32(dpi/0.0254 + 0.5)
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint32(data[0:], ppm)
+	binary.BigEndian.PutUint32(data[4:], ppm)
+	data[8] = 1 // the unit is meter
+	return pngChunk("pHYs", data)
+}
+
+// pngChunk returns the PNG chunk of the type and the data
+func pngChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8+len(data)+4)
+	binary.BigEndian.PutUint32(chunk[0:], uint32(len(data)))
+	copy(chunk[4:], typ)
+	copy(chunk[8:], data)
+	binary.BigEndian.PutUint32(chunk[8+len(data):], crc32.ChecksumIEEE(chunk[4:8+len(data)]))
+	return chunk
+}
@@ -0,0 +1,162 @@
+package germanium
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/webp"
+)
+
+func TestEncoder(t *testing.T) {
+	img, err := NewRenderer(WithLanguage("go")).RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format   string
+		decode   func(io.Reader) (image.Image, error)
+		lossless bool
+	}{
+		{format: FormatPNG, decode: png.Decode, lossless: true},
+		{format: FormatJPEG, decode: jpeg.Decode},
+		{format: FormatGIF, decode: gif.Decode},
+		{format: FormatBMP, decode: bmp.Decode, lossless: true},
+		{format: FormatWebP, decode: webp.Decode, lossless: true},
+	}
+
+	for _, tt := range tests {
+		encode, err := Encoder(tt.format, DefaultJPEGQuality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := encode(&buf, img); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		got, err := tt.decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+
+		if got.Bounds() != img.Bounds() {
+			t.Errorf("%s: bounds = %v, want %v", tt.format, got.Bounds(), img.Bounds())
+			continue
+		}
+		if tt.lossless {
+			if x, y, ok := samePixels(img, got); !ok {
+				t.Errorf("%s: pixel at %d,%d differs", tt.format, x, y)
+			}
+		}
+	}
+
+	if _, err := Encoder(FormatJPEG, 0); err == nil {
+		t.Errorf("no error for JPEG quality 0")
+	}
+	if _, err := Encoder("tiff", DefaultJPEGQuality); err == nil {
+		t.Errorf("no error for unsupported format")
+	}
+}
+
+func TestEncodeWebPAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 37, 11))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 37; x++ {
+			if c := color.NRGBAModel.Convert(got.At(x, y)); c != img.NRGBAAt(x, y) {
+				t.Fatalf("pixel at %d,%d = %v, want %v", x, y, c, img.NRGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestEncodeWebPTransforms(t *testing.T) {
+	code, err := NewRenderer(WithLanguage("go")).RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noise := image.NewNRGBA(image.Rect(0, 0, 37, 11))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+
+	for _, img := range []image.Image{code, noise} {
+		b := img.Bounds()
+		argb, opaque := argbPixels(img)
+		for _, transforms := range [][]int{
+			{vp8lSubtractGreenTransform},
+			{vp8lSubtractGreenTransform, vp8lPredictorTransform},
+		} {
+			data := encodeVP8L(argb, b.Dx(), b.Dy(), opaque, transforms)
+			got, err := webp.Decode(bytes.NewReader(riffVP8L(data)))
+			if err != nil {
+				t.Fatalf("%v: %v", transforms, err)
+			}
+			if x, y, ok := samePixels(img, got); !ok {
+				t.Errorf("%v: pixel at %d,%d differs", transforms, x, y)
+			}
+		}
+	}
+
+	// the image of the code is compressed at least as well as in PNG
+	var webpBuf, pngBuf bytes.Buffer
+	if err := encodeWebP(&webpBuf, code); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngBuf, code); err != nil {
+		t.Fatal(err)
+	}
+	if webpBuf.Len() > pngBuf.Len() {
+		t.Errorf("WebP of %d bytes, larger than PNG of %d bytes", webpBuf.Len(), pngBuf.Len())
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	// the image of few colors keeps them
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < 16*16; i++ {
+		img.Set(i%16, i/16, color.RGBA{uint8(i % 3 * 100), 0, 0, 255})
+	}
+	if p := (medianCut{}).Quantize(make(color.Palette, 0, 256), img); len(p) != 3 {
+		t.Errorf("palette of %d colors, want 3", len(p))
+	}
+
+	// the image of many colors is reduced to the capacity of the palette
+	for i := 0; i < 16*16; i++ {
+		img.Set(i%16, i/16, color.RGBA{uint8(i), uint8(255 - i), uint8(i * 7), 255})
+	}
+	if p := (medianCut{}).Quantize(make(color.Palette, 0, 16), img); len(p) != 16 {
+		t.Errorf("palette of %d colors, want 16", len(p))
+	}
+}
+
+// samePixels reports whether the images have the same colors, or returns
+// the first pixel differing
+func samePixels(a, b image.Image) (int, int, bool) {
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.RGBA64Model.Convert(a.At(x, y)) != color.RGBA64Model.Convert(b.At(x, y)) {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
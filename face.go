@@ -0,0 +1,140 @@
+package germanium
+
+import (
+	"image"
+	"math"
+
+	"github.com/alecthomas/chroma/v2"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// slant of the synthetic italic face
+const syntheticSlant = 0.2
+
+// fontFaces holds the faces used for the bold and italic tokens
+type fontFaces struct {
+	regular    font.Face
+	bold       font.Face
+	italic     font.Face
+	boldItalic font.Face
+}
+
+// newFontFaces returns the faces, synthesizing the missing variants from
+// the regular face
+func newFontFaces(regular, bold, italic, boldItalic font.Face) *fontFaces {
+	if bold == nil {
+		bold = &syntheticFace{Face: regular, bold: true}
+	}
+	if italic == nil {
+		italic = &syntheticFace{Face: regular, italic: true}
+	}
+	if boldItalic == nil {
+		boldItalic = &syntheticFace{Face: bold, italic: true}
+	}
+
+	return &fontFaces{
+		regular:    regular,
+		bold:       bold,
+		italic:     italic,
+		boldItalic: boldItalic,
+	}
+}
+
+// face returns the face for the style entry
+func (f *fontFaces) face(entry chroma.StyleEntry) font.Face {
+	bold, italic := entry.Bold == chroma.Yes, entry.Italic == chroma.Yes
+	switch {
+	case bold && italic:
+		return f.boldItalic
+	case bold:
+		return f.bold
+	case italic:
+		return f.italic
+	}
+	return f.regular
+}
+
+// SetFontVariants sets the faces used for the bold, italic and bold italic
+// tokens of the style. A nil face is synthesized from the regular one by
+// emboldening or slanting the glyphs.
+func (p *Panel) SetFontVariants(bold, italic, boldItalic font.Face) {
+	p.faces = newFontFaces(p.fontFace, bold, italic, boldItalic)
+}
+
+// syntheticFace emboldens or slants the glyphs of Face
+type syntheticFace struct {
+	font.Face
+	bold   bool
+	italic bool
+}
+
+// Glyph returns the transformed glyph of the underlying face
+func (s *syntheticFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	dr, mask, maskp, advance, ok := s.Face.Glyph(dot, r)
+	if !ok || dr.Empty() {
+		return dr, mask, maskp, advance, ok
+	}
+
+	// stroke width of the synthetic bold face
+	strength := 0
+	if s.bold {
+		strength = s.Metrics().Ascent.Round() / 24
+		if strength < 1 {
+			strength = 1
+		}
+	}
+
+	baseline := dot.Y.Round()
+	shift := func(y int) float64 {
+		if !s.italic {
+			return 0
+		}
+		return float64(baseline-y) - 0.5
+	}
+
+	out := image.NewAlpha(image.Rect(
+		dr.Min.X+int(math.Floor(shift(dr.Max.Y)*syntheticSlant)),
+		dr.Min.Y,
+		dr.Max.X+int(math.Ceil(shift(dr.Min.Y)*syntheticSlant))+strength+1,
+		dr.Max.Y,
+	))
+
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		offset := shift(y) * syntheticSlant
+		whole := int(math.Floor(offset))
+		frac := offset - float64(whole)
+
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			_, _, _, a := mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+			if a == 0 {
+				continue
+			}
+			v := float64(a >> 8)
+
+			// spread the pixel between two pixels for the sub-pixel slant
+			addAlpha(out, x+whole, y, v*(1-frac))
+			addAlpha(out, x+whole+1, y, v*frac)
+		}
+
+		// thicken the strokes to the right for bold
+		row := out.Pix[out.PixOffset(out.Rect.Min.X, y) : out.PixOffset(out.Rect.Max.X-1, y)+1]
+		for x := len(row) - 1; x >= 0; x-- {
+			for k := 1; k <= strength && x-k >= 0; k++ {
+				if row[x-k] > row[x] {
+					row[x] = row[x-k]
+				}
+			}
+		}
+	}
+
+	return out.Rect, out, out.Rect.Min, advance, true
+}
+
+func addAlpha(img *image.Alpha, x, y int, v float64) {
+	i := img.PixOffset(x, y)
+	if i < 0 || i >= len(img.Pix) || !(image.Point{x, y}.In(img.Rect)) {
+		return
+	}
+	img.Pix[i] = uint8(math.Min(255, float64(img.Pix[i])+v))
+}
@@ -0,0 +1,83 @@
+package germanium
+
+import (
+	"image"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// FallbackFace is a font.Face drawing each rune with the first font of the
+// chain which has its glyph. Runes missing in every font are drawn with the
+// first font.
+type FallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+var _ font.Face = (*FallbackFace)(nil)
+
+// NewFallbackFace returns the face of the font chain at the size
+func NewFallbackFace(size float64, fonts ...*truetype.Font) *FallbackFace {
+	faces := make([]font.Face, len(fonts))
+	for i, ft := range fonts {
+		faces[i] = truetype.NewFace(ft, &truetype.Options{Size: size})
+	}
+	return NewFallbackFaceWith(fonts, faces)
+}
+
+// NewFallbackFaceWith returns the chain of the faces, where faces[i] is a
+// face of fonts[i]
+func NewFallbackFaceWith(fonts []*truetype.Font, faces []font.Face) *FallbackFace {
+	return &FallbackFace{fonts: fonts, faces: faces}
+}
+
+// face returns the face to draw the rune
+func (f *FallbackFace) face(r rune) font.Face {
+	for i, ft := range f.fonts {
+		if ft.Index(r) != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+// Close closes all the faces
+func (f *FallbackFace) Close() error {
+	for _, face := range f.faces {
+		if err := face.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Glyph returns the glyph of the first face which has it
+func (f *FallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.face(r).Glyph(dot, r)
+}
+
+// GlyphBounds returns the bounds of the glyph of the first face which has it
+func (f *FallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.face(r).GlyphBounds(r)
+}
+
+// GlyphAdvance returns the advance of the glyph of the first face which has it
+func (f *FallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.face(r).GlyphAdvance(r)
+}
+
+// Kern returns the kerning of the runes if they are drawn with the same face
+func (f *FallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.face(r0)
+	if face != f.face(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+// Metrics returns the metrics of the first face, which lays out the lines
+func (f *FallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
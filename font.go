@@ -0,0 +1,35 @@
+package germanium
+
+import (
+	_ "embed" // embed font data
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// DefaultFontName is the name of the font drawing the source code unless
+// another face is given
+const DefaultFontName = "Hack-Regular"
+
+var (
+	//go:embed font/Hack-Regular.ttf
+	fontHack []byte
+
+	defaultFontOnce sync.Once
+	defaultFont     *truetype.Font
+	defaultFontErr  error
+)
+
+// DefaultFontData returns the data of the default font, Hack Regular
+func DefaultFontData() []byte {
+	return fontHack
+}
+
+// parseDefaultFont returns the default font, which is parsed once and
+// shared by the renders making their faces from it
+func parseDefaultFont() (*truetype.Font, error) {
+	defaultFontOnce.Do(func() {
+		defaultFont, defaultFontErr = truetype.Parse(fontHack)
+	})
+	return defaultFont, defaultFontErr
+}
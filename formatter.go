@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/alecthomas/chroma/v2"
 	"golang.org/x/image/font"
@@ -18,101 +20,200 @@ type Formatter interface {
 	Format(w io.Writer, style *chroma.Style, iterator chroma.Iterator) error
 }
 
-// PNGFormatter is a formatter for PNG
+// PNGFormatter is a formatter for PNG and the other raster formats. It
+// draws the source code on the image, then encodes the image by its encoder.
 type PNGFormatter struct {
-	fontSize   float64
-	drawer     *font.Drawer
-	startPoint image.Point
-	hasLineNum bool
+	fontSize    float64
+	drawer      *font.Drawer
+	startPoint  image.Point
+	hasLineNum  bool
+	highlight   *lineHighlight
+	firstLine   int
+	diff        *Diff
+	window      image.Rectangle
+	faces       *fontFaces
+	widthMode   string
+	encode      func(io.Writer, image.Image) error
+	lineSpacing float64
+	// lineCount is the number of the lines of the whole source code, which
+	// keeps the width of the line numbers while it is typed
+	lineCount int
 }
 
 // NewPNGFormatter generates a new PNG formatter
 func NewPNGFormatter(fs float64, d *font.Drawer, sp image.Point, l bool) *PNGFormatter {
 	return &PNGFormatter{
-		fontSize:   fs,
-		drawer:     d,
-		startPoint: sp,
-		hasLineNum: l,
+		fontSize:    fs,
+		drawer:      d,
+		startPoint:  sp,
+		hasLineNum:  l,
+		firstLine:   1,
+		faces:       newFontFaces(d.Face, nil, nil, nil),
+		widthMode:   WidthGlyph,
+		encode:      png.Encode,
+		lineSpacing: DefaultLayout.LineSpacing,
 	}
 }
 
 // Format formats the source code on the image
 func (f *PNGFormatter) Format(w io.Writer, style *chroma.Style, iterator chroma.Iterator) error {
-	return f.format(w, style, iterator.Tokens())
+	f.draw(style, iterator.Tokens())
+	return f.encode(w, f.drawer.Dst)
 }
 
-func (f *PNGFormatter) format(w io.Writer, style *chroma.Style, tokens []chroma.Token) error {
+// draw draws the tokens on the image and returns the point where the
+// character following them would be drawn
+func (f *PNGFormatter) draw(style *chroma.Style, tokens []chroma.Token) fixed.Point26_6 {
 	left := fixed.Int26_6(f.startPoint.X * 64)
 	y := fixed.Int26_6(f.startPoint.Y * 64)
 
 	lines := chroma.SplitTokensIntoLines(tokens)
-	format := fmt.Sprintf("%%%dd", len(strconv.Itoa(len(lines)))+1)
+	lineCount := len(lines)
+	if lineCount < f.lineCount {
+		lineCount = f.lineCount
+	}
+	digits := len(strconv.Itoa(f.firstLine + lineCount - 1))
+	format := fmt.Sprintf("%%%dd", digits+1)
+
+	metrics := f.drawer.Face.Metrics()
+	fg := chooseColorBasedOnContrast(windowBackground(style))
+	lineHeight := int(f.fontSize * f.lineSpacing)
+
+	gutter := 0
+	if f.diff != nil {
+		gutter = f.diff.gutterWidth(f.hasLineNum)
+	} else if f.hasLineNum {
+		gutter = digits + 1
+	}
+	sx := left + f.drawer.MeasureString(" ") + fixed.I(f.drawer.MeasureString(" ").Round()*gutter)
 
 	for i, tokens := range lines {
-		y += fixed.I(int(f.fontSize))
-		if i > 0 {
-			y += fixed.I(int(f.fontSize * 0.25)) // padding between lines
+		if i == 0 {
+			y += fixed.I(int(f.fontSize))
+		} else {
+			y += fixed.I(lineHeight)
+		}
+
+		if f.highlight != nil && f.highlight.contains(f.firstLine+i) {
+			band := f.highlight.band(y.Round(), metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+			draw.Draw(f.drawer.Dst, band, image.NewUniform(f.highlight.color), image.Point{}, draw.Over)
 		}
 
-		if f.hasLineNum {
+		if f.diff != nil {
+			if bg, ok := f.diff.background(i); ok {
+				band := lineBand(f.window.Min.X, f.window.Max.X, y.Round(), metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+				draw.Draw(f.drawer.Dst, band, image.NewUniform(bg), image.Point{}, draw.Over)
+			}
+
+			numbers, marker := f.diff.gutter(i, f.hasLineNum)
 			f.drawer.Dot.X = left
 			f.drawer.Dot.Y = y
-			f.drawer.Src = image.NewUniform(chooseColorBasedOnContrast())
-			f.drawer.DrawString(fmt.Sprintf(format, i+1))
+			f.drawer.Src = image.NewUniform(fg)
+			f.drawer.DrawString(numbers)
+			f.drawer.Src = image.NewUniform(f.diff.markerColor(i, fg))
+			f.drawer.DrawString(marker)
+		} else if f.hasLineNum {
+			f.drawer.Dot.X = left
+			f.drawer.Dot.Y = y
+			f.drawer.Src = image.NewUniform(f.highlight.dim(fg, f.firstLine+i))
+			f.drawer.DrawString(fmt.Sprintf(format, f.firstLine+i))
 		}
 
-		sx := left + f.drawer.MeasureString(" ")
-		if f.hasLineNum {
-			sx += fixed.I(f.drawer.MeasureString(" ").Round() * (len(strconv.Itoa(len(lines))) + 1))
+		if f.diff != nil && f.diff.Lines[i].Kind == DiffHunk {
+			f.drawer.Dot.X = sx
+			f.drawer.Src = image.NewUniform(tokenColor(style, chroma.GenericSubheading))
+			f.drawer.DrawString(f.diff.Lines[i].Text)
+			continue
 		}
 
 		f.drawer.Dot.X = sx
 		for _, t := range tokens {
-			var tokenColor color.Color
-			chromaTokenColor := style.Get(t.Type).Colour
-			if chromaTokenColor == 0 {
-				// if token has no color, try to use the color of the Text token
-				chromaTokenColor = style.Get(chroma.Text).Colour
+			entry := style.Get(t.Type)
+			tc := f.highlight.dim(tokenColor(style, t.Type), f.firstLine+i)
+			f.drawer.Face = f.faces.face(entry)
+			clusters, width := layoutText(f.drawer.Face, t.Value, f.widthMode)
+			start := f.drawer.Dot.X
+			end := start + width
+
+			if bg, ok := tokenBackground(style, entry); ok {
+				band := lineBand(start.Round(), end.Round(), y.Round(), metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+				draw.Draw(f.drawer.Dst, band, image.NewUniform(bg), image.Point{}, draw.Over)
+			}
+
+			f.drawer.Src = image.NewUniform(tc)
+			for _, c := range clusters {
+				drawCluster(f.drawer, c, start+c.x, y, f.widthMode)
 			}
-			if chromaTokenColor != 0 {
-				tokenColor = color.RGBA{
-					chromaTokenColor.Red(),
-					chromaTokenColor.Green(),
-					chromaTokenColor.Blue(),
-					255,
-				}
-			} else {
-				// found no suitable color for token, so use white if background color is close
-				// to black and use black if background color is close to white
-				tokenColor = chooseColorBasedOnContrast()
+			f.drawer.Dot.X = end
+
+			if entry.Underline == chroma.Yes {
+				top := y.Round() + metrics.Descent.Round()/3
+				line := image.Rect(start.Round(), top, end.Round(), top+underlineThickness(f.fontSize))
+				draw.Draw(f.drawer.Dst, line, image.NewUniform(tc), image.Point{}, draw.Over)
 			}
+		}
+		f.drawer.Face = f.faces.regular
+	}
 
-			f.drawer.Src = image.NewUniform(tokenColor)
+	if n := len(tokens); n == 0 {
+		return fixed.Point26_6{X: sx, Y: y + fixed.I(int(f.fontSize))}
+	} else if strings.HasSuffix(tokens[n-1].Value, "\n") {
+		return fixed.Point26_6{X: sx, Y: y + fixed.I(lineHeight)}
+	}
+	return fixed.Point26_6{X: f.drawer.Dot.X, Y: y}
+}
 
-			for _, c := range t.String() {
-				if c == '\n' {
-					f.drawer.Dot.X = sx
-					continue
-				}
-				if c == '\t' {
-					f.drawer.Dot.X += f.drawer.MeasureString("    ")
-					continue
-				}
+// tokenBackground returns the background color of the style entry if it
+// differs from the background of the style
+func tokenBackground(style *chroma.Style, entry chroma.StyleEntry) (color.Color, bool) {
+	bg := entry.Background
+	if !bg.IsSet() || bg == style.Get(chroma.Background).Background {
+		return nil, false
+	}
+	return color.RGBA{bg.Red(), bg.Green(), bg.Blue(), 255}, true
+}
 
-				px := f.drawer.MeasureString(fmt.Sprintf("%c", c)).Round()
+// underlineThickness returns the thickness of the underline for the font size
+func underlineThickness(fontSize float64) int {
+	if t := int(fontSize / 16); t > 1 {
+		return t
+	}
+	return 1
+}
 
-				f.drawer.Dot.X += fixed.Int26_6(px)
-				f.drawer.Dot.Y = y
-				f.drawer.DrawString(fmt.Sprintf("%c", c))
-			}
-		}
+// tokenColor returns the color of the token type in the style
+func tokenColor(style *chroma.Style, tt chroma.TokenType) color.Color {
+	chromaTokenColor := style.Get(tt).Colour
+	if chromaTokenColor == 0 {
+		// if token has no color, try to use the color of the Text token
+		chromaTokenColor = style.Get(chroma.Text).Colour
+	}
+	if chromaTokenColor == 0 {
+		// found no suitable color for token, so use white if background color is close
+		// to black and use black if background color is close to white
+		return chooseColorBasedOnContrast(windowBackground(style))
+	}
+
+	return color.RGBA{
+		chromaTokenColor.Red(),
+		chromaTokenColor.Green(),
+		chromaTokenColor.Blue(),
+		255,
 	}
+}
 
-	return png.Encode(w, f.drawer.Dst)
+// windowBackground returns the background color of the Chroma style, if it
+// exists, or the default window background color
+func windowBackground(style *chroma.Style) color.RGBA {
+	bg := style.Get(chroma.Background).Background
+	if bg == 0 {
+		return defaultWindowBackgroundColor
+	}
+	return color.RGBA{R: bg.Red(), G: bg.Green(), B: bg.Blue(), A: 255}
 }
 
 // Choose white or black color based on window background color
-func chooseColorBasedOnContrast() color.Color {
+func chooseColorBasedOnContrast(windowBackgroundColor color.Color) color.Color {
 	black := color.Black
 	white := color.White
 	colorIndex := color.Palette{black, white}.Index(windowBackgroundColor)
@@ -3,6 +3,7 @@ module github.com/matsuyoshi30/germanium
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/alecthomas/chroma/v2 v2.8.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/jessevdk/go-flags v1.5.0
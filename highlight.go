@@ -0,0 +1,130 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// alpha of the highlight band derived from the style
+const highlightAlpha = 0xc0
+
+// LineRange is an inclusive range of line numbers
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ParseLineRanges parses comma separated line numbers and ranges such as
+// '3,7-12'
+func ParseLineRanges(s string) ([]LineRange, error) {
+	var ranges []LineRange
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		start, end := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			start, end = field[:i], field[i+1:]
+		}
+
+		s, err := strconv.Atoi(strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line range: %s", field)
+		}
+		e, err := strconv.Atoi(strings.TrimSpace(end))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line range: %s", field)
+		}
+		if s < 1 || e < s {
+			return nil, fmt.Errorf("invalid line range: %s", field)
+		}
+
+		ranges = append(ranges, LineRange{Start: s, End: e})
+	}
+
+	return ranges, nil
+}
+
+// Highlight holds the lines emphasized with a background band
+type Highlight struct {
+	Lines []LineRange
+	// Color of the band, derived from the LineHighlight entry of the style if empty
+	Color string
+	// Dim draws the lines which are not highlighted faded
+	Dim bool
+}
+
+// contains reports whether the line is highlighted
+func (h Highlight) contains(line int) bool {
+	for _, r := range h.Lines {
+		if r.Start <= line && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHighlight sets the lines to highlight
+func (p *Panel) SetHighlight(h Highlight) {
+	p.highlight = h
+}
+
+// lineHighlight is the highlight resolved for a formatter
+type lineHighlight struct {
+	Highlight
+	color color.NRGBA
+	// horizontal extent of the band
+	left, right int
+}
+
+// resolveHighlight returns the highlight with the band color and extent
+func (p *Panel) resolveHighlight(style *chroma.Style) (*lineHighlight, error) {
+	if len(p.highlight.Lines) == 0 {
+		return nil, nil
+	}
+
+	h := &lineHighlight{
+		Highlight: p.highlight,
+		left:      p.window.Min.X - p.px.radius,
+		right:     p.window.Max.X + p.px.radius,
+	}
+
+	switch bg := style.Get(chroma.LineHighlight).Background; {
+	case p.highlight.Color != "":
+		c, err := parseColor(p.highlight.Color)
+		if err != nil {
+			return nil, err
+		}
+		h.color = c
+	case bg.IsSet():
+		h.color = color.NRGBA{R: bg.Red(), G: bg.Green(), B: bg.Blue(), A: highlightAlpha}
+	default:
+		c := color.NRGBAModel.Convert(chooseColorBasedOnContrast(windowBackground(style))).(color.NRGBA)
+		c.A = 0x30
+		h.color = c
+	}
+
+	return h, nil
+}
+
+// band returns the rectangle behind the line whose baseline is at y
+func (h *lineHighlight) band(y int, ascent, descent, lineHeight int) image.Rectangle {
+	return lineBand(h.left, h.right, y, ascent, descent, lineHeight)
+}
+
+// dim fades the color of the text on the lines which are not highlighted
+func (h *lineHighlight) dim(c color.Color, line int) color.Color {
+	if h == nil || !h.Dim || h.contains(line) {
+		return c
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	n.A /= 3
+	return n
+}
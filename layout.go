@@ -0,0 +1,83 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+)
+
+// Layout holds the metrics placing the window and the source code on the
+// image. The size of the image, the window and the position of each line are
+// all derived from it.
+type Layout struct {
+	// PaddingX and PaddingY are the margins around the window
+	PaddingX int
+	PaddingY int
+	// InnerPadding is the space between the edge of the window and the text
+	InnerPadding int
+	// LineSpacing is the height of a line relative to the font size
+	LineSpacing float64
+}
+
+// DefaultLayout is the layout used unless another one is set
+var DefaultLayout = Layout{
+	PaddingX:     paddingWidth - radius,
+	PaddingY:     paddingHeight - radius,
+	InnerPadding: radius,
+	LineSpacing:  1.25,
+}
+
+// validate reports an error if the metrics are out of range
+func (l Layout) validate() error {
+	if l.PaddingX < 0 || l.PaddingY < 0 || l.InnerPadding < 0 {
+		return fmt.Errorf("invalid padding: %d, %d, %d", l.PaddingX, l.PaddingY, l.InnerPadding)
+	}
+	if l.LineSpacing < 1 {
+		return fmt.Errorf("invalid line spacing: %g", l.LineSpacing)
+	}
+	return nil
+}
+
+// CalcWidth calculates the image width from the length of the longest line
+// of the source code, the line number and the room needed by the shadow
+func (l Layout) CalcWidth(maxLineLen int, lineNumberWidth int, shadow Shadow) int {
+	left, _, right, _ := shadow.margin(l)
+	return maxLineLen + (l.PaddingX+l.InnerPadding)*2 + lineNumberWidth + left + right
+}
+
+// CalcHeight calculates the image height from the number of lines of the
+// source code, the access bar of the window style and the room needed by the
+// shadow
+func (l Layout) CalcHeight(lineCount int, fontSize float64, window WindowStyle, shadow Shadow) int {
+	_, top, _, bottom := shadow.margin(l)
+	h := (lineCount * l.lineHeight(fontSize)) + int(fontSize) + (l.PaddingY+l.InnerPadding)*2 + top + bottom
+	h += window.BarHeight
+
+	return h
+}
+
+// lineHeight returns the distance between the baselines of the lines
+func (l Layout) lineHeight(fontSize float64) int {
+	return int(fontSize * l.LineSpacing)
+}
+
+// frame returns the rectangle of the window on the image of the size
+func (l Layout) frame(size image.Point, shadow Shadow) image.Rectangle {
+	left, top, right, bottom := shadow.margin(l)
+	return image.Rect(l.PaddingX+left, l.PaddingY+top, size.X-l.PaddingX-right, size.Y-l.PaddingY-bottom)
+}
+
+// startPoint returns the top left of the text in the window, whose source
+// code is offset from the top
+func (l Layout) startPoint(frame image.Rectangle, offset int) image.Point {
+	return image.Point{X: frame.Min.X + l.InnerPadding, Y: frame.Min.Y + l.InnerPadding + offset}
+}
+
+// SetLayout sets the padding and the line spacing
+func (p *Panel) SetLayout(l Layout) error {
+	if err := l.validate(); err != nil {
+		return err
+	}
+
+	p.metrics = l
+	return nil
+}
@@ -0,0 +1,108 @@
+package germanium
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// LexerCache keeps the lexers found by the language or the file extension,
+// so that the sources rendered with the same language share the lookup. It
+// is safe for concurrent use.
+type LexerCache struct {
+	mu     sync.Mutex
+	lexers map[string]chroma.Lexer
+}
+
+// NewLexerCache returns an empty LexerCache
+func NewLexerCache() *LexerCache {
+	return &LexerCache{lexers: make(map[string]chroma.Lexer)}
+}
+
+// Get returns the lexer of the language, or of the file name if the
+// language is empty. A nil LexerCache looks up the lexer every time.
+func (c *LexerCache) Get(filename, language string) chroma.Lexer {
+	if c == nil {
+		return findLexer(filename, language)
+	}
+
+	key := "language:" + language
+	if language == "" {
+		key = lexerKey(filename)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lexer, ok := c.lexers[key]
+	if !ok {
+		lexer = findLexer(filename, language)
+		c.lexers[key] = lexer
+	}
+	return lexer
+}
+
+// extensionGlob matches the globs of the lexers matching the file names by
+// their extension alone
+var extensionGlob = regexp.MustCompile(`^\*\.[0-9A-Za-z_+-]+$`)
+
+var (
+	nameGlobsOnce sync.Once
+	nameGlobs     []string
+)
+
+// lexerKey returns the key of the lexer of the file name in LexerCache. The
+// files of the same extension share the key, unless a lexer matches the
+// other parts of their names like Makefile.bak or CMakeLists.txt.
+func lexerKey(filename string) string {
+	base := filepath.Base(filename)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" || strings.Contains(stem, ".") || !extensionGlob.MatchString("*"+ext) {
+		return "file:" + base
+	}
+
+	nameGlobsOnce.Do(func() {
+		for _, lexer := range lexers.GlobalLexerRegistry.Lexers {
+			config := lexer.Config()
+			for _, glob := range append(append([]string(nil), config.Filenames...), config.AliasFilenames...) {
+				if !extensionGlob.MatchString(glob) {
+					nameGlobs = append(nameGlobs, glob)
+				}
+			}
+		}
+	})
+	// the names of the globs followed by a backup suffix match by the stem
+	for _, glob := range nameGlobs {
+		if ok, _ := filepath.Match(glob, base); ok {
+			return "file:" + base
+		}
+		if ok, _ := filepath.Match(glob, stem); ok {
+			return "file:" + base
+		}
+	}
+	return "ext:" + ext
+}
+
+// findLexer returns the lexer of the language or the file name, or the
+// fallback lexer
+func findLexer(filename, language string) chroma.Lexer {
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	} else {
+		lexer = lexers.Get(filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return chroma.Coalesce(lexer)
+}
+
+// SetLexerCache sets the cache of the lexers shared with the other panels
+func (p *Panel) SetLexerCache(c *LexerCache) {
+	p.lexers = c
+}
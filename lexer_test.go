@@ -0,0 +1,39 @@
+package germanium
+
+import "testing"
+
+func TestLexerKey(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "src/main.go", want: "ext:.go"},
+		{filename: "panel_test.go", want: "ext:.go"},
+		{filename: "notes.txt", want: "ext:.txt"},
+		{filename: "CMakeLists.txt", want: "file:CMakeLists.txt"},
+		{filename: "Makefile", want: "file:Makefile"},
+		{filename: "Makefile.bak", want: "file:Makefile.bak"},
+		{filename: "main.go.bak", want: "file:main.go.bak"},
+		{filename: ".bashrc", want: "file:.bashrc"},
+		{filename: "ls.1", want: "file:ls.1"},
+	}
+
+	for _, tt := range tests {
+		if got := lexerKey(tt.filename); got != tt.want {
+			t.Errorf("%s: key = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestLexerCache(t *testing.T) {
+	c := NewLexerCache()
+	for _, name := range []string{"a.txt", "CMakeLists.txt", "b.txt"} {
+		got, want := c.Get(name, "").Config().Name, findLexer(name, "").Config().Name
+		if got != want {
+			t.Errorf("%s: lexer = %s, want %s", name, got, want)
+		}
+	}
+	if c.Get("a.go", "") != c.Get("b.go", "") {
+		t.Errorf("lexer of the same extension is not shared")
+	}
+}
@@ -2,35 +2,40 @@ package germanium
 
 import (
 	"bufio"
+	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
+	"image/png"
 	"io"
-	"strings"
-	"unicode/utf8"
+	"strconv"
 
 	"github.com/alecthomas/chroma/v2"
-	"github.com/alecthomas/chroma/v2/formatters"
-	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
 	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
 )
 
 const (
 	paddingWidth        = 60
 	paddingHeight       = 60
-	windowHeight        = 20 * 3
 	windowHeightNoBar   = 10
 	lineNumberWidthBase = 40
 
 	FontSizeBase = 24.0
 
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
 	radius = 10
+
+	// DefaultCornerRadius is the radius of the corners of the window by
+	// default
+	DefaultCornerRadius = radius
 )
 
 var (
 	// default window background color
-	windowBackgroundColor = color.RGBA{40, 42, 54, 255}
+	defaultWindowBackgroundColor = color.RGBA{40, 42, 54, 255}
 
 	// button color
 	close   = color.RGBA{255, 95, 86, 255}
@@ -41,18 +46,17 @@ var (
 // CalcWidth calculates the image width from the length of the longest line of
 // the source code, padding and line number
 func CalcWidth(maxLineLen int, lineNumberWidth int) int {
-	return maxLineLen + (paddingWidth * 2) + lineNumberWidth
+	return DefaultLayout.CalcWidth(maxLineLen, lineNumberWidth, Shadow{})
 }
 
 // CalcHeight calculates the image height from the number of lines of the
-// source code, padding and access bar
+// source code, padding and access bar of the macOS window
 func CalcHeight(lineCount int, fontSize float64, noWindowAccessBar bool) int {
-	h := (lineCount * int((fontSize * 1.25))) + int(fontSize) + (paddingHeight * 2)
-	if !noWindowAccessBar {
-		h += windowHeight
+	window := WindowStyleMacOS
+	if noWindowAccessBar {
+		window = WindowStyleNone
 	}
-
-	return h
+	return DefaultLayout.CalcHeight(lineCount, fontSize, window, Shadow{})
 }
 
 // Drawer implements Draw()
@@ -73,223 +77,301 @@ var _ Labeler = (*Panel)(nil)
 func NewImage(src io.Reader, face font.Face, fontSize float64, style, backgroundColor string, noWindowAccessBar, noLineNum bool) (*Panel, error) {
 	scanner := bufio.NewScanner(src)
 
-	var ret, ln int
+	var lines []string
 	for scanner.Scan() {
-		str := strings.ReplaceAll(scanner.Text(), "\t", "    ") // replace tab to whitespace
-
-		if ret < utf8.RuneCountInString(str) {
-			ret = utf8.RuneCountInString(str)
-		}
-		ln++
+		lines = append(lines, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	width := CalcWidth(
-		font.MeasureString(face, " ").Ceil()*(ret+1),
-		// adjust the width of the line number area based on font size
-		int(lineNumberWidthBase*fontSize/FontSizeBase),
-	)
-	height := CalcHeight(ln, fontSize, noWindowAccessBar)
-
-	p := NewPanel(0, 0, width, height)
+	p := &Panel{}
+	p.lines = lines
+	p.lineRange = LineRange{Start: 1, End: len(lines)}
 	p.style = style
+	p.windowColor = windowBackground(styles.Get(style))
 	p.bgColor = backgroundColor
-	p.noWindowAccessBar = noWindowAccessBar
+	p.windowStyle = WindowStyleMacOS
+	if noWindowAccessBar {
+		p.windowStyle = WindowStyleNone
+	}
 	p.noLineNum = noLineNum
 	p.fontFace = face
 	p.fontSize = fontSize
+	p.faces = newFontFaces(face, nil, nil, nil)
+	p.format = FormatPNG
+	p.fontFamily = defaultSVGFontFamily
+	p.widthMode = WidthGlyph
+	p.metrics = DefaultLayout
+	p.scale = 1
+	p.cornerRadius = DefaultCornerRadius
+	p.encode = png.Encode
 
 	return p, nil
 }
 
-// Panel holds an image and formatter
-type Panel struct {
-	img               *image.RGBA
-	style             string
-	bgColor           string
-	noWindowAccessBar bool
-	noLineNum         bool
-	Formatter         Formatter
-	fontFace          font.Face
-	fontSize          float64
-}
+// layout allocates the image sized for the lines to render and places the
+// window on it. The setters only record the settings, which are laid out
+// once by Draw.
+func (p *Panel) layout() error {
+	p.px = p.scaled()
+
+	// measure the lines with the face drawing them, so that the glyphs of
+	// the fallback fonts are not clipped
+	ret := p.tokenWidth
+	for _, l := range p.lines[p.lineRange.Start-1 : p.lineRange.End] {
+		if w := textWidth(p.fontFace, l, p.widthMode).Ceil(); ret < w {
+			ret = w
+		}
+	}
+	ln := p.lineRange.End - p.lineRange.Start + 1
 
-// NewPanel generates new panel
-func NewPanel(sx, sy, ex, ey int) *Panel {
-	return &Panel{img: image.NewRGBA(image.Rect(sx, sy, ex, ey))}
-}
+	space := font.MeasureString(p.fontFace, " ").Ceil()
 
-// Draw draws the editor image on the base panel
-func (p *Panel) Draw() error {
-	bg, err := ParseHexColor(p.bgColor)
-	if err != nil {
-		return err
+	// adjust the width of the line number area based on font size
+	lineNumberWidth := int(lineNumberWidthBase * p.fontSize / FontSizeBase)
+	if w := space * (len(strconv.Itoa(p.lineNumber(p.lineRange.End))) + 1); lineNumberWidth < w {
+		lineNumberWidth = w
+	}
+	if p.diff != nil {
+		lineNumberWidth = space * p.diff.gutterWidth(!p.noLineNum)
 	}
 
-	width := p.img.Rect.Dx()
-	height := p.img.Rect.Dy()
+	width := p.px.layout.CalcWidth(ret+space, lineNumberWidth, p.px.shadow)
+	height := p.px.layout.CalcHeight(ln, p.fontSize, p.px.window, p.px.shadow)
+	if p.maxPixels > 0 && int64(width)*int64(height) > int64(p.maxPixels) {
+		return fmt.Errorf("image is too large: %dx%d", width, height)
+	}
 
-	// base image
-	p.fillColor(bg)
+	p.img = image.NewRGBA(image.Rect(0, 0, width, height))
+	// the corners of the window are rounded around this rectangle
+	p.window = p.px.layout.frame(p.img.Rect.Size(), p.px.shadow).Inset(p.px.radius)
+	return nil
+}
 
-	// use the background color of the Chroma style, if it exists
-	chromaStyle := styles.Get(p.style)
-	chromaBackgroundColor := chromaStyle.Get(chroma.Background).Background
-	if chromaBackgroundColor != 0 {
-		windowBackgroundColor = color.RGBA{
-			R: chromaBackgroundColor.Red(),
-			G: chromaBackgroundColor.Green(),
-			B: chromaBackgroundColor.Blue(),
-			A: 255,
-		}
-	}
+// SetMaxPixels limits the number of the pixels of the image, which is
+// rejected by Draw before it is allocated. The image is not limited if n
+// is 0.
+func (p *Panel) SetMaxPixels(n int) {
+	p.maxPixels = n
+}
 
-	p.drawWindowPanel(width, height)
+// SetEncoder sets the function encoding the raster image, which is the
+// Encoder of the format by default
+func (p *Panel) SetEncoder(encode func(io.Writer, image.Image) error) {
+	p.encode = encode
+}
 
-	// window control bar
-	if p.noWindowAccessBar {
-		p.drawWindowControlPanel(width, windowHeightNoBar)
-	} else {
-		p.drawWindowControlPanel(width, windowHeight)
+// SetFormat sets the image format, FormatSVG or one of the raster formats
+// encoded by their Encoder, which is FormatPNG by default
+func (p *Panel) SetFormat(format string) error {
+	var encode func(io.Writer, image.Image) error
+	if format != FormatSVG {
+		var err error
+		encode, err = Encoder(format, DefaultJPEGQuality)
+		if err != nil {
+			return err
+		}
 	}
 
-	// round corner
-	p.drawAround(width, height)
-
+	p.format = format
+	p.encode = encode
 	return nil
 }
 
-func (p *Panel) drawWindowPanel(w, h int) {
-	window := NewPanel(paddingWidth, paddingHeight, w-paddingWidth, h-paddingHeight)
-	window.fillColor(windowBackgroundColor)
-	draw.Draw(p.img, p.img.Bounds(), window.img, image.Point{0, 0}, draw.Over)
+// Image returns the image drawn by Draw and Label
+func (p *Panel) Image() image.Image {
+	return p.img
 }
 
-func (p *Panel) drawWindowControlPanel(w, h int) {
-	wc := NewPanel(paddingWidth, paddingHeight, w-paddingWidth, paddingHeight+h)
-	wc.fillColor(windowBackgroundColor)
+// SetLineRange limits the rendered lines to the range of the source code.
+// The whole source code is still lexed so that the highlighting of the
+// lines stays correct.
+func (p *Panel) SetLineRange(r LineRange) error {
+	if r.Start < 1 || r.End < r.Start || r.Start > len(p.lines) {
+		return fmt.Errorf("invalid line range: %d-%d", r.Start, r.End)
+	}
+	if r.End > len(p.lines) {
+		r.End = len(p.lines)
+	}
 
-	wc.drawControlButtons()
+	p.lineRange = r
+	return nil
+}
 
-	draw.Draw(p.img, p.img.Bounds(), wc.img, image.Point{0, 0}, draw.Over)
+// SetLineNumberStart sets the line number of the first rendered line,
+// which defaults to its line number in the source code
+func (p *Panel) SetLineNumberStart(n int) {
+	p.lineNumberStart = n
 }
 
-func (p *Panel) drawControlButtons() {
-	for i, bc := range []color.RGBA{close, minimum, maximum} {
-		center := image.Point{X: paddingWidth + (i * 30) + 20, Y: paddingHeight + 10*2}
-		p.drawCircle(center, radius, bc)
+// lineNumber returns the line number displayed for the line of the source code
+func (p *Panel) lineNumber(line int) int {
+	if p.lineNumberStart == 0 {
+		return line
 	}
+	return line - p.lineRange.Start + p.lineNumberStart
 }
 
-func (p *Panel) drawAround(w, h int) {
-	p.drawRound(w, h)
-	p.drawAroundBar(w, h)
+// Panel holds an image and formatter. A Panel must not be used by several
+// goroutines at once, while separate Panels can be rendered concurrently.
+type Panel struct {
+	img             *image.RGBA
+	window          image.Rectangle
+	shadow          Shadow
+	lines           []string
+	lineRange       LineRange
+	lineNumberStart int
+	style           string
+	windowColor     color.RGBA
+	bgColor         string
+	bgGradient      *Gradient
+	bgImage         image.Image
+	bgImageMode     string
+	windowStyle     WindowStyle
+	noLineNum       bool
+	highlight       Highlight
+	diff            *Diff
+	ansi            bool
+	ansiPalette     string
+	Formatter       Formatter
+	fontFace        font.Face
+	faces           *fontFaces
+	fontSize        float64
+	format          string
+	fontFamily      string
+	fontData        []byte
+	widthMode       string
+	title           Title
+	metrics         Layout
+	encode          func(io.Writer, image.Image) error
+	lexers          *LexerCache
+	scale           float64
+	cornerRadius    int
+	maxPixels       int
+	tokenWidth      int
+	px              scaled
 }
 
-func (p *Panel) drawRound(w, h int) {
-	round := NewPanel(paddingWidth-radius, paddingHeight-radius, w-paddingWidth+radius, h-paddingHeight+radius)
-	corners := []image.Point{
-		{paddingWidth, paddingHeight},
-		{w - paddingWidth, paddingHeight},
-		{paddingWidth, h - paddingHeight},
-		{w - paddingWidth, h - paddingHeight},
-	}
-	for _, c := range corners {
-		round.drawCircle(c, radius, windowBackgroundColor)
-	}
-	draw.Draw(p.img, p.img.Bounds(), round.img, image.Point{0, 0}, draw.Over)
+// NewPanel generates new panel
+func NewPanel(sx, sy, ex, ey int) *Panel {
+	return &Panel{img: image.NewRGBA(image.Rect(sx, sy, ex, ey))}
 }
 
-func (p *Panel) drawAroundBar(w, h int) {
-	aroundbars := []*Panel{
-		NewPanel(paddingWidth-radius, paddingHeight, paddingWidth, h-paddingHeight),
-		NewPanel(paddingWidth, paddingHeight-radius, w-paddingWidth, paddingHeight),
-		NewPanel(w-paddingWidth, paddingHeight, w-paddingWidth+radius, h-paddingHeight),
-		NewPanel(paddingWidth, h-paddingHeight, w-paddingWidth, h-paddingHeight+radius),
-	}
-	for _, ab := range aroundbars {
-		ab.fillColor(windowBackgroundColor)
-		draw.Draw(p.img, p.img.Bounds(), ab.img, image.Point{0, 0}, draw.Over)
-	}
+// SetSVGFont sets the font family referenced by SVG output, a comma
+// separated list of fonts. If data is not empty, the glyphs of the first
+// font used by the source code are embedded in the SVG.
+func (p *Panel) SetSVGFont(family string, data []byte) {
+	p.fontFamily = family
+	p.fontData = data
 }
 
-// fillColor set color per pixel
-func (p *Panel) fillColor(c color.RGBA) {
-	for x := p.img.Rect.Min.X; x < p.img.Rect.Max.X; x++ {
-		for y := p.img.Rect.Min.Y; y < p.img.Rect.Max.Y; y++ {
-			p.img.Set(x, y, c)
-		}
+// Draw lays out the panel with its settings, and draws the editor image on
+// the base panel
+func (p *Panel) Draw() error {
+	if err := p.layout(); err != nil {
+		return err
+	}
+
+	bg, err := p.backgroundColor()
+	if err != nil {
+		return err
 	}
-}
 
-// drawCircle draw circle over r.img
-func (p *Panel) drawCircle(center image.Point, radius int, c color.RGBA) {
-	x := radius
-	y := 0
-	err := 0
+	// base image
+	p.drawBackground(bg)
 
-	// Function to check if you're on the edges (avoid pixels at the ends)
-	isEdge := func(i, axis, radius int) bool {
-		return i == axis-radius || i == axis+radius
+	if err := p.drawShadow(); err != nil {
+		return err
 	}
 
-	// Filling the circle
-	for x >= y {
-		// Draw pixels in the eight octants
-		for i := center.X - x; i <= center.X+x; i++ {
-			// Do not desine pixels at horizontal ends
-			if !(y == 0 && isEdge(i, center.X, radius)) {
-				p.img.Set(i, center.Y+y, c) // Octant 1 and 2
-				p.img.Set(i, center.Y-y, c) // Octant 3 and 4
-			}
-		}
+	p.drawWindowPanel()
 
-		for i := center.X - y; i <= center.X+y; i++ {
-			// Do not draw pixels at vertical ends
-			if !(x == radius && y == 0) {
-				p.img.Set(i, center.Y+x, c) // Octant 5 and 6
-				p.img.Set(i, center.Y-x, c) // Octant 7 and 8
-			}
-		}
+	// window control bar
+	p.drawWindowBar()
 
-		// Update error and circle variables
-		if err <= 0 {
-			y++
-			err += 2*y + 1
-		}
-		if err > 0 {
-			x--
-			err -= 2*x + 1
-		}
-	}
+	return nil
+}
+
+// drawWindowPanel draws the window with the rounded corners
+func (p *Panel) drawWindowPanel() {
+	fillShape(p.img, roundedRect(p.window.Inset(-p.px.radius), p.px.corner), p.windowColor, p.img.Bounds())
 }
 
 // Label labels highlighted source code on panel
 func (p *Panel) Label(out io.Writer, src io.Reader, filename, language string) error {
-	var lexer chroma.Lexer
-	if language != "" {
-		lexer = lexers.Get(language)
-	} else {
-		lexer = lexers.Get(filename)
+	chromaStyle, tokens, err := p.label(src, filename, language)
+	if err != nil {
+		return err
 	}
-	if lexer == nil {
-		lexer = lexers.Fallback
+
+	if err := p.Formatter.Format(out, chromaStyle, chroma.Literator(tokens...)); err != nil {
+		return err
 	}
-	lexer = chroma.Coalesce(lexer)
+
+	return nil
+}
+
+// label sets the formatter for the file and returns the style and the
+// tokens of the lines to render
+func (p *Panel) label(src io.Reader, filename, language string) (*chroma.Style, []chroma.Token, error) {
+	lexer := p.lexers.Get(filename, language)
 
 	chromaStyle := styles.Get(p.style)
 
 	b, err := io.ReadAll(src)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	var all []chroma.Token
+	if p.ansi {
+		chromaStyle, all, err = ansiTokens(string(b), chromaStyle, p.ansiPalette)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		iterator, err := lexer.Tokenise(nil, string(b))
+		if err != nil {
+			return nil, nil, err
+		}
+		all = iterator.Tokens()
 	}
 
-	iterator, err := lexer.Tokenise(nil, string(b))
+	// lex the whole source code, then keep the lines to render
+	lines := chroma.SplitTokensIntoLines(all)
+	if end := p.lineRange.End; end < len(lines) {
+		lines = lines[:end]
+	}
+	if start := p.lineRange.Start - 1; start < len(lines) {
+		lines = lines[start:]
+	}
+	var tokens []chroma.Token
+	for _, l := range lines {
+		tokens = append(tokens, l...)
+	}
+
+	// the lines were measured with the regular face, while the bold and
+	// italic tokens are drawn with their own faces
+	if w := p.linesWidth(chromaStyle, lines); w > p.tokenWidth {
+		p.tokenWidth = w
+		if p.img != nil {
+			if err := p.Draw(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if p.img == nil {
+		if err := p.layout(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	highlight, err := p.resolveHighlight(chromaStyle)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	firstLine := p.lineNumber(p.lineRange.Start)
 
 	drawer := &font.Drawer{
 		Dst:  p.img,
@@ -297,19 +379,64 @@ func (p *Panel) Label(out io.Writer, src io.Reader, filename, language string) e
 		Face: p.fontFace,
 	}
 
-	spy := paddingHeight
-	if p.noWindowAccessBar {
-		spy += windowHeightNoBar
-	} else {
-		spy += windowHeight
+	sp := p.px.layout.startPoint(p.window.Inset(-p.px.radius), p.px.codeOffset)
+	switch p.format {
+	case FormatSVG:
+		chrome, err := p.svgWindow(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		f := NewSVGFormatter(p.fontSize, p.fontFace, sp, !p.noLineNum, p.img.Rect.Size(), chrome)
+		f.fontFamily = p.fontFamily
+		f.highlight = highlight
+		f.firstLine = firstLine
+		f.diff = p.diff
+		f.window = p.window.Inset(-p.px.radius)
+		f.widthMode = p.widthMode
+		f.lineSpacing = p.metrics.LineSpacing
+		if len(p.fontData) > 0 {
+			f.fontData, err = SubsetFont(p.fontData, p.svgGlyphs(tokens, filename))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		p.Formatter = f
+	default:
+		if err := p.drawTitle(filename); err != nil {
+			return nil, nil, err
+		}
+		f := NewPNGFormatter(p.fontSize, drawer, sp, !p.noLineNum)
+		f.highlight = highlight
+		f.firstLine = firstLine
+		f.diff = p.diff
+		f.window = p.window.Inset(-p.px.radius)
+		f.faces = p.faces
+		f.widthMode = p.widthMode
+		f.lineSpacing = p.metrics.LineSpacing
+		f.encode = p.encode
+		p.Formatter = f
 	}
-	sp := image.Point{X: paddingWidth, Y: spy}
-	p.Formatter = NewPNGFormatter(p.fontSize, drawer, sp, !p.noLineNum)
-	formatters.Register("png", p.Formatter)
 
-	if err := p.Formatter.Format(out, chromaStyle, iterator); err != nil {
-		return err
-	}
+	return chromaStyle, tokens, nil
+}
 
-	return nil
+// linesWidth returns the width of the widest line, measuring each token
+// with the face the formatter draws it with
+func (p *Panel) linesWidth(style *chroma.Style, lines [][]chroma.Token) int {
+	var ret int
+	for i, tokens := range lines {
+		// the hunk headers are drawn with the regular face
+		if p.diff != nil && i < len(p.diff.Lines) && p.diff.Lines[i].Kind == DiffHunk {
+			continue
+		}
+
+		var width fixed.Int26_6
+		for _, t := range tokens {
+			width += textWidth(p.faces.face(style.Get(t.Type)), t.Value, p.widthMode)
+		}
+		if w := width.Ceil(); ret < w {
+			ret = w
+		}
+	}
+	return ret
 }
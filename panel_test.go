@@ -0,0 +1,170 @@
+package germanium
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+const testSource = `package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("Hello world")
+}
+`
+
+// the styles with dark and light backgrounds, and without a background
+var testStyles = []string{"dracula", "monokai", "solarized-dark", "autumn", "github", "solarized-light", "pygments", "bw"}
+
+func render(fontData []byte, style, format string) ([]byte, error) {
+	ft, err := truetype.Parse(fontData)
+	if err != nil {
+		return nil, err
+	}
+	face := truetype.NewFace(ft, &truetype.Options{Size: FontSizeBase})
+
+	p, err := NewImage(strings.NewReader(testSource), face, FontSizeBase, style, "#aaaaff", false, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.SetFormat(format); err != nil {
+		return nil, err
+	}
+	p.SetHighlight(Highlight{Lines: []LineRange{{Start: 3, End: 3}}})
+	p.SetTitle(Title{Text: style})
+	if err := p.Draw(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := p.Label(&out, strings.NewReader(testSource), "main.go", "go"); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// TestRenderConcurrently renders the styles in parallel goroutines and
+// compares the images with the ones rendered one by one. Run with -race.
+func TestRenderConcurrently(t *testing.T) {
+	fontData, err := os.ReadFile(filepath.Join("font", "Hack-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatPNG, FormatSVG} {
+		want := make(map[string][]byte)
+		for _, style := range testStyles {
+			b, err := render(fontData, style, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want[style] = b
+		}
+
+		var wg sync.WaitGroup
+		got := make([][]byte, len(testStyles)*4)
+		errs := make([]error, len(got))
+		for i := range got {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				got[i], errs[i] = render(fontData, testStyles[i%len(testStyles)], format)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, b := range got {
+			style := testStyles[i%len(testStyles)]
+			if errs[i] != nil {
+				t.Fatalf("%s: %v", style, errs[i])
+			}
+			if !bytes.Equal(want[style], b) {
+				t.Errorf("%s output differs when rendered concurrently: %s", format, style)
+			}
+		}
+	}
+}
+
+// TestLayoutOnDraw checks that the setters only record the settings, which
+// are laid out by Draw
+func TestLayoutOnDraw(t *testing.T) {
+	fontData, err := os.ReadFile(filepath.Join("font", "Hack-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := truetype.Parse(fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := truetype.NewFace(ft, &truetype.Options{Size: FontSizeBase})
+
+	p, err := NewImage(strings.NewReader(testSource), face, FontSizeBase, "dracula", "#aaaaff", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	img := p.Image()
+	size := img.Bounds().Size()
+
+	l := DefaultLayout
+	l.PaddingX *= 2
+	if err := p.SetLayout(l); err != nil {
+		t.Fatal(err)
+	}
+	if p.Image() != img {
+		t.Errorf("setter replaced the drawn image")
+	}
+
+	if err := p.Draw(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Image().Bounds().Dx(), size.X+2*DefaultLayout.PaddingX; got != want {
+		t.Errorf("width = %d, want %d", got, want)
+	}
+}
+
+func TestLayoutFontVariants(t *testing.T) {
+	fontData, err := os.ReadFile(filepath.Join("font", "Hack-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := truetype.Parse(fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := truetype.NewFace(ft, &truetype.Options{Size: FontSizeBase})
+	// the keywords are bold in the style
+	wide := truetype.NewFace(ft, &truetype.Options{Size: FontSizeBase * 3})
+
+	const source = "package main\n"
+	width := func(bold font.Face) int {
+		p, err := NewImage(strings.NewReader(source), face, FontSizeBase, "bw", "#aaaaff", false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.SetFontVariants(bold, nil, nil)
+		if err := p.Draw(); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Label(&bytes.Buffer{}, strings.NewReader(source), "main.go", "go"); err != nil {
+			t.Fatal(err)
+		}
+		return p.Image().Bounds().Dx()
+	}
+
+	// the line is widened by the bold keyword
+	want := width(nil) + (textWidth(wide, "package", WidthGlyph) - textWidth(face, "package", WidthGlyph)).Floor()
+	if got := width(wide); got < want {
+		t.Errorf("width with the wide bold face = %d, want at least %d", got, want)
+	}
+}
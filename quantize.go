@@ -0,0 +1,127 @@
+package germanium
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// medianCut is draw.Quantizer choosing the palette by the median cut of the
+// colors of the image. The image keeps its colors if they fit in the
+// palette, as the most of the images of source code do.
+type medianCut struct{}
+
+// colorCount is a color of the image and the number of its pixels
+type colorCount struct {
+	c     color.RGBA
+	count int
+}
+
+// Quantize appends the colors chosen for the image to the palette up to its
+// capacity
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	n := cap(p) - len(p)
+	if n <= 0 {
+		return p
+	}
+
+	counts := make(map[color.RGBA]int)
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[color.RGBAModel.Convert(m.At(x, y)).(color.RGBA)]++
+		}
+	}
+	colors := make([]colorCount, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, colorCount{c, count})
+	}
+
+	if len(colors) <= n {
+		for _, c := range colors {
+			p = append(p, c.c)
+		}
+		return p
+	}
+
+	// split the box of the most pixels at the median of its widest channel
+	// until there are as many boxes as the colors of the palette
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		i, most := -1, 0
+		for j, box := range boxes {
+			if total := pixels(box); len(box) > 1 && total > most {
+				i, most = j, total
+			}
+		}
+		if i < 0 {
+			break
+		}
+
+		box := boxes[i]
+		ch := widestChannel(box)
+		sort.Slice(box, func(a, b int) bool { return channel(box[a].c, ch) < channel(box[b].c, ch) })
+		half, mid := 0, 1
+		for ; mid < len(box)-1; mid++ {
+			if half += box[mid-1].count; half*2 >= most {
+				break
+			}
+		}
+		boxes[i] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	for _, box := range boxes {
+		p = append(p, average(box))
+	}
+	return p
+}
+
+// pixels returns the number of the pixels of the colors
+func pixels(colors []colorCount) int {
+	total := 0
+	for _, c := range colors {
+		total += c.count
+	}
+	return total
+}
+
+// channel returns the value of the channel of the color, R, G, B and A for
+// 0 to 3
+func channel(c color.RGBA, ch int) uint8 {
+	return [4]uint8{c.R, c.G, c.B, c.A}[ch]
+}
+
+// widestChannel returns the channel whose values spread the most
+func widestChannel(colors []colorCount) int {
+	widest, spread := 0, -1
+	for ch := 0; ch < 4; ch++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range colors {
+			v := channel(c.c, ch)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if int(hi)-int(lo) > spread {
+			widest, spread = ch, int(hi)-int(lo)
+		}
+	}
+	return widest
+}
+
+// average returns the average of the colors weighted by their pixels
+func average(colors []colorCount) color.RGBA {
+	var r, g, b, a, total int
+	for _, c := range colors {
+		r += int(c.c.R) * c.count
+		g += int(c.c.G) * c.count
+		b += int(c.c.B) * c.count
+		a += int(c.c.A) * c.count
+		total += c.count
+	}
+	return color.RGBA{uint8(r / total), uint8(g / total), uint8(b / total), uint8(a / total)}
+}
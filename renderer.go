@@ -0,0 +1,435 @@
+package germanium
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// Renderer renders source code into images with its options. A Renderer
+// can be used by several goroutines at once, unless it is given a font face
+// by WithFontFace, which is not safe for concurrent use.
+type Renderer struct {
+	face            font.Face
+	fontSize        float64
+	bold            font.Face
+	italic          font.Face
+	boldItalic      font.Face
+	style           string
+	background      string
+	gradient        *Gradient
+	bgImage         image.Image
+	bgImageMode     string
+	shadow          Shadow
+	layout          Layout
+	lineNumbers     bool
+	windowStyle     WindowStyle
+	cornerRadius    int
+	title           Title
+	lineRange       *LineRange
+	lineNumberStart int
+	highlight       Highlight
+	diff            bool
+	ansi            bool
+	ansiPalette     string
+	widthMode       string
+	format          string
+	quality         int
+	scale           float64
+	svgFontFamily   string
+	svgFontData     []byte
+	language        string
+	filename        string
+	encode          func(io.Writer, image.Image) error
+	lexers          *LexerCache
+	animation       *Animation
+	maxPixels       int
+}
+
+// Option configures a Renderer
+type Option func(*Renderer)
+
+// NewRenderer returns a Renderer with the options. By default the source
+// code is drawn with Hack, as the command does, in the dracula style with
+// line numbers, in the macOS window.
+func NewRenderer(opts ...Option) *Renderer {
+	r := &Renderer{
+		fontSize:     FontSizeBase,
+		style:        "dracula",
+		background:   "#aaaaff",
+		lineNumbers:  true,
+		windowStyle:  WindowStyleMacOS,
+		cornerRadius: DefaultCornerRadius,
+		widthMode:    WidthGlyph,
+		format:       FormatPNG,
+		quality:      DefaultJPEGQuality,
+		scale:        1,
+		layout:       DefaultLayout,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithStyle sets the Chroma style for syntax highlighting
+func WithStyle(style string) Option {
+	return func(r *Renderer) { r.style = style }
+}
+
+// WithFontFace sets the face drawing the source code at the font size. The
+// face must be made at the font size multiplied by the scale of WithScale.
+func WithFontFace(face font.Face, size float64) Option {
+	return func(r *Renderer) {
+		r.face = face
+		r.fontSize = size
+	}
+}
+
+// WithFontVariants sets the faces of the bold, italic and bold italic
+// tokens, which are synthesized if nil
+func WithFontVariants(bold, italic, boldItalic font.Face) Option {
+	return func(r *Renderer) {
+		r.bold = bold
+		r.italic = italic
+		r.boldItalic = boldItalic
+	}
+}
+
+// WithBackground sets the background color of the image, which can be
+// BackgroundTransparent
+func WithBackground(color string) Option {
+	return func(r *Renderer) { r.background = color }
+}
+
+// WithBackgroundGradient draws the gradient as the background
+func WithBackgroundGradient(g *Gradient) Option {
+	return func(r *Renderer) { r.gradient = g }
+}
+
+// WithBackgroundImage draws the image as the background in the mode
+func WithBackgroundImage(img image.Image, mode string) Option {
+	return func(r *Renderer) {
+		r.bgImage = img
+		r.bgImageMode = mode
+	}
+}
+
+// WithShadow draws the shadow behind the window
+func WithShadow(s Shadow) Option {
+	return func(r *Renderer) { r.shadow = s }
+}
+
+// WithPadding sets the margins around the window
+func WithPadding(x, y int) Option {
+	return func(r *Renderer) {
+		r.layout.PaddingX = x
+		r.layout.PaddingY = y
+	}
+}
+
+// WithLayout sets the padding and the line spacing
+func WithLayout(l Layout) Option {
+	return func(r *Renderer) { r.layout = l }
+}
+
+// WithLineNumbers shows or hides the line numbers
+func WithLineNumbers(show bool) Option {
+	return func(r *Renderer) { r.lineNumbers = show }
+}
+
+// WithWindowStyle sets the window chrome
+func WithWindowStyle(s WindowStyle) Option {
+	return func(r *Renderer) { r.windowStyle = s }
+}
+
+// WithCornerRadius sets the radius of the corners of the window, which are
+// square if the radius is 0
+func WithCornerRadius(n int) Option {
+	return func(r *Renderer) { r.cornerRadius = n }
+}
+
+// WithTitle sets the title in the window access bar
+func WithTitle(t Title) Option {
+	return func(r *Renderer) { r.title = t }
+}
+
+// WithLineRange renders only the line range of the source code
+func WithLineRange(lr LineRange) Option {
+	return func(r *Renderer) { r.lineRange = &lr }
+}
+
+// WithLineNumberStart sets the line number of the first rendered line
+func WithLineNumberStart(n int) Option {
+	return func(r *Renderer) { r.lineNumberStart = n }
+}
+
+// WithHighlight highlights the lines
+func WithHighlight(h Highlight) Option {
+	return func(r *Renderer) { r.highlight = h }
+}
+
+// WithDiff renders the source, which is unified diff, with the added and
+// removed lines. It cannot be combined with WithLineRange and WithHighlight.
+func WithDiff() Option {
+	return func(r *Renderer) { r.diff = true }
+}
+
+// WithANSI renders the source as the terminal output colored by the ANSI
+// escape sequences instead of highlighting it, in the named palette of
+// ANSIPalettes. ANSIPaletteStyle derives the palette from the style.
+func WithANSI(palette string) Option {
+	return func(r *Renderer) {
+		r.ansi = true
+		r.ansiPalette = palette
+	}
+}
+
+// WithWidthMode sets how the width of the characters is measured
+func WithWidthMode(mode string) Option {
+	return func(r *Renderer) { r.widthMode = mode }
+}
+
+// WithFormat sets the image format, FormatSVG or one of the raster formats
+// FormatPNG, FormatJPEG, FormatGIF, FormatBMP and FormatWebP
+func WithFormat(format string) Option {
+	return func(r *Renderer) { r.format = format }
+}
+
+// WithScale multiplies the font size and all the metrics of the layout,
+// the window, the shadow and the tiles of the background image by the
+// scale for HiDPI displays. PNG images
+// record the resolution, so that they are displayed at the size of the
+// scale 1. The faces given by WithFontFace, WithFontVariants and WithTitle
+// must be made at their font size multiplied by the scale.
+func WithScale(scale float64) Option {
+	return func(r *Renderer) { r.scale = scale }
+}
+
+// WithQuality sets the quality of JPEG images from 1 to 100
+func WithQuality(quality int) Option {
+	return func(r *Renderer) { r.quality = quality }
+}
+
+// WithSVGFont sets the font family referenced by SVG output and the font
+// data embedded in it
+func WithSVGFont(family string, data []byte) Option {
+	return func(r *Renderer) {
+		r.svgFontFamily = family
+		r.svgFontData = data
+	}
+}
+
+// WithLanguage sets the language for syntax highlighting
+func WithLanguage(language string) Option {
+	return func(r *Renderer) { r.language = language }
+}
+
+// WithFilename sets the file name, which chooses the language unless
+// WithLanguage is given and can be the title
+func WithFilename(filename string) Option {
+	return func(r *Renderer) { r.filename = filename }
+}
+
+// WithEncoder sets the function encoding the raster image, which is the
+// Encoder of the format by default
+func WithEncoder(encode func(io.Writer, image.Image) error) Option {
+	return func(r *Renderer) { r.encode = encode }
+}
+
+// WithMaxPixels limits the number of the pixels of the image, so that a
+// render is rejected before allocating a too large image
+func WithMaxPixels(n int) Option {
+	return func(r *Renderer) { r.maxPixels = n }
+}
+
+// WithLexerCache shares the lexers found by the language or the file name
+// with the other renders using the cache
+func WithLexerCache(c *LexerCache) Option {
+	return func(r *Renderer) { r.lexers = c }
+}
+
+// WithAnimation renders the animation of the source code into an animated
+// GIF for FormatGIF, or an APNG for FormatPNG. The encoder of WithEncoder is
+// not used for the animation.
+func WithAnimation(a Animation) Option {
+	return func(r *Renderer) { r.animation = &a }
+}
+
+// Render renders the source code into w with the options
+func Render(ctx context.Context, w io.Writer, src io.Reader, opts ...Option) error {
+	return NewRenderer(opts...).Render(ctx, w, src)
+}
+
+// Render renders the source code into w
+func (r *Renderer) Render(ctx context.Context, w io.Writer, src io.Reader) error {
+	_, err := r.render(ctx, w, src, r.encode)
+	return err
+}
+
+// RenderImage renders the source code and returns the image without
+// encoding it
+func (r *Renderer) RenderImage(ctx context.Context, src io.Reader) (image.Image, error) {
+	if r.format == FormatSVG {
+		return nil, fmt.Errorf("image is not rendered in %s format", r.format)
+	}
+	if r.animation != nil {
+		return nil, fmt.Errorf("animation is not rendered as an image")
+	}
+
+	p, err := r.render(ctx, io.Discard, src, func(io.Writer, image.Image) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	return p.Image(), nil
+}
+
+func (r *Renderer) render(ctx context.Context, w io.Writer, src io.Reader, encode func(io.Writer, image.Image) error) (*Panel, error) {
+	source, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := r.filename
+	var diff *Diff
+	if r.diff {
+		diff, err = ParseDiff(bytes.NewReader(source))
+		if err != nil {
+			return nil, err
+		}
+		source = []byte(diff.Source())
+		if filename == "" {
+			filename = diff.Filename
+		}
+	}
+
+	if r.ansi && r.diff {
+		return nil, fmt.Errorf("ANSI colored output is not rendered as diff")
+	}
+	// the diff markers are indexed by the lines of the whole diff
+	if r.diff && (r.lineRange != nil || len(r.highlight.Lines) > 0) {
+		return nil, fmt.Errorf("line range and highlight are not rendered in diff")
+	}
+
+	if r.background == BackgroundTransparent && r.format == FormatJPEG {
+		return nil, fmt.Errorf("transparent background is not supported in %s format", r.format)
+	}
+	if r.scale <= 0 {
+		return nil, fmt.Errorf("invalid scale: %g", r.scale)
+	}
+	fontSize := r.fontSize * r.scale
+
+	face := r.face
+	if face == nil {
+		ft, err := parseDefaultFont()
+		if err != nil {
+			return nil, err
+		}
+		face = truetype.NewFace(ft, &truetype.Options{Size: fontSize})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p, err := NewImage(bytes.NewReader(source), face, fontSize, r.style, r.background, false, !r.lineNumbers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.SetFormat(r.format); err != nil {
+		return nil, err
+	}
+	if err := p.SetShadow(r.shadow); err != nil {
+		return nil, err
+	}
+	if err := p.SetLayout(r.layout); err != nil {
+		return nil, err
+	}
+	if err := p.SetScale(r.scale); err != nil {
+		return nil, err
+	}
+	if diff != nil {
+		p.SetDiff(diff)
+	}
+	if r.ansi {
+		if err := p.SetANSI(r.ansiPalette); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.SetWidthMode(r.widthMode); err != nil {
+		return nil, err
+	}
+	p.SetWindowStyle(r.windowStyle)
+	if err := p.SetCornerRadius(r.cornerRadius); err != nil {
+		return nil, err
+	}
+	p.SetFontVariants(r.bold, r.italic, r.boldItalic)
+	if r.lineRange != nil {
+		if err := p.SetLineRange(*r.lineRange); err != nil {
+			return nil, err
+		}
+	}
+	if r.lineNumberStart != 0 {
+		p.SetLineNumberStart(r.lineNumberStart)
+	}
+	title := r.title
+	title.FontSize *= r.scale
+	p.SetTitle(title)
+	p.SetHighlight(r.highlight)
+	if r.gradient != nil {
+		p.SetBackgroundGradient(r.gradient)
+	}
+	if r.bgImage != nil {
+		if err := p.SetBackgroundImage(r.bgImage, r.bgImageMode); err != nil {
+			return nil, err
+		}
+	}
+	if r.svgFontFamily != "" {
+		p.SetSVGFont(r.svgFontFamily, r.svgFontData)
+	}
+	if encode == nil && r.format != FormatSVG {
+		encode, err = Encoder(r.format, r.quality)
+		if err != nil {
+			return nil, err
+		}
+		if r.format == FormatPNG && r.scale != 1 {
+			encode = pngEncoder(baseDPI * r.scale)
+		}
+	}
+	if encode != nil {
+		p.SetEncoder(encode)
+	}
+	p.SetLexerCache(r.lexers)
+	p.SetMaxPixels(r.maxPixels)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := p.Draw(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if r.animation != nil {
+		if err := p.Animate(w, bytes.NewReader(source), filename, r.language, *r.animation); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	if err := p.Label(w, bytes.NewReader(source), filename, r.language); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,236 @@
+package germanium
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func TestRender(t *testing.T) {
+	fontData, err := os.ReadFile(filepath.Join("font", "Hack-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := render(fontData, "dracula", FormatPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ft, err := truetype.Parse(fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face := truetype.NewFace(ft, &truetype.Options{Size: FontSizeBase})
+
+	r := NewRenderer(
+		WithFontFace(face, FontSizeBase),
+		WithStyle("dracula"),
+		WithLanguage("go"),
+		WithHighlight(Highlight{Lines: []LineRange{{Start: 3, End: 3}}}),
+		WithTitle(Title{Text: "dracula"}),
+	)
+
+	var got bytes.Buffer
+	if err := r.Render(context.Background(), &got, strings.NewReader(testSource)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got.Bytes()) {
+		t.Errorf("output differs from the panel")
+	}
+
+	img, err := r.RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantImg, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != wantImg.Bounds() {
+		t.Errorf("image bounds = %v, want %v", img.Bounds(), wantImg.Bounds())
+	}
+
+	// the default font is the one of the command
+	got.Reset()
+	err = Render(context.Background(), &got, strings.NewReader(testSource),
+		WithStyle("dracula"),
+		WithLanguage("go"),
+		WithHighlight(Highlight{Lines: []LineRange{{Start: 3, End: 3}}}),
+		WithTitle(Title{Text: "dracula"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got.Bytes()) {
+		t.Errorf("output of the default font differs from Hack")
+	}
+}
+
+func TestRenderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Render(ctx, &bytes.Buffer{}, strings.NewReader(testSource), WithLanguage("go"))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRenderScale(t *testing.T) {
+	var one, two bytes.Buffer
+	if err := Render(context.Background(), &one, strings.NewReader(testSource), WithLanguage("go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Render(context.Background(), &two, strings.NewReader(testSource), WithLanguage("go"), WithScale(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg1, err := png.DecodeConfig(bytes.NewReader(one.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg2, err := png.DecodeConfig(bytes.NewReader(two.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the advances of the glyphs are rounded at each size
+	if dx := cfg2.Width - 2*cfg1.Width; dx < -4 || dx > 4 {
+		t.Errorf("width = %d, want about %d", cfg2.Width, 2*cfg1.Width)
+	}
+	if dy := cfg2.Height - 2*cfg1.Height; dy < -4 || dy > 4 {
+		t.Errorf("height = %d, want about %d", cfg2.Height, 2*cfg1.Height)
+	}
+
+	if bytes.Contains(one.Bytes(), []byte("pHYs")) {
+		t.Errorf("pHYs chunk is written at scale 1")
+	}
+	// 144 DPI is 5669 pixels per meter
+	phys := []byte{0, 0, 0, 9, 'p', 'H', 'Y', 's', 0, 0, 0x16, 0x25, 0, 0, 0x16, 0x25, 1}
+	if !bytes.Contains(two.Bytes(), phys) {
+		t.Errorf("pHYs chunk of 144 DPI is not written")
+	}
+}
+
+func TestRenderScaleTile(t *testing.T) {
+	tile := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+	rand.New(rand.NewSource(1)).Read(tile.Pix)
+	for i := 3; i < len(tile.Pix); i += 4 {
+		tile.Pix[i] = 0xff
+	}
+
+	r := NewRenderer(WithLanguage("go"), WithScale(2), WithBackgroundImage(tile, BackgroundTile))
+	img, err := r.RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tiles of 6 pixels repeat in the padding
+	same := func(x0, y0, x1, y1 int) bool {
+		return color.RGBAModel.Convert(img.At(x0, y0)) == color.RGBAModel.Convert(img.At(x1, y1))
+	}
+	unscaled := true
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 24; x++ {
+			if !same(x, y, x+6, y) || !same(x, y, x, y+6) {
+				t.Fatalf("pixel at %d,%d differs from the next tile", x, y)
+			}
+			unscaled = unscaled && same(x, y, x+3, y)
+		}
+	}
+	if unscaled {
+		t.Errorf("tiles are not scaled")
+	}
+}
+
+func TestRenderTransparent(t *testing.T) {
+	r := NewRenderer(WithLanguage("go"), WithBackground(BackgroundTransparent))
+	img, err := r.RenderImage(context.Background(), strings.NewReader(testSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := img.Bounds()
+	if _, _, _, a := img.At(b.Min.X, b.Min.Y).RGBA(); a != 0 {
+		t.Errorf("alpha outside the window = %d, want 0", a)
+	}
+	if _, _, _, a := img.At(b.Dx()/2, b.Dy()/2).RGBA(); a != 0xffff {
+		t.Errorf("alpha inside the window = %d, want %d", a, 0xffff)
+	}
+
+	err = Render(context.Background(), &bytes.Buffer{}, strings.NewReader(testSource),
+		WithLanguage("go"), WithBackground(BackgroundTransparent), WithFormat(FormatJPEG))
+	if err == nil {
+		t.Errorf("transparent JPEG is rendered")
+	}
+}
+
+func TestRenderDiffLines(t *testing.T) {
+	diff := `--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+-var a = 1
++var a = 2
+`
+	tests := []struct {
+		desc string
+		opt  Option
+	}{
+		{"line range", WithLineRange(LineRange{Start: 2, End: 3})},
+		{"highlight", WithHighlight(Highlight{Lines: []LineRange{{Start: 2, End: 2}}})},
+	}
+	for _, tt := range tests {
+		err := Render(context.Background(), &bytes.Buffer{}, strings.NewReader(diff), WithDiff(), tt.opt)
+		if err == nil {
+			t.Errorf("diff with %s is rendered", tt.desc)
+		}
+	}
+}
+
+func TestRenderSVGFontSubset(t *testing.T) {
+	var out bytes.Buffer
+	err := Render(context.Background(), &out, strings.NewReader("a\nb\n"), WithLanguage("plaintext"),
+		WithFormat(FormatSVG), WithSVGFont("Hack", DefaultFontData()), WithLineRange(LineRange{Start: 1, End: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := out.String()
+	start := strings.Index(svg, "base64,") + len("base64,")
+	end := start + strings.Index(svg[start:], ")")
+	data, err := base64.StdEncoding.DecodeString(svg[start:end])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := truetype.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the glyphs of the lines out of the range are not embedded
+	var g truetype.GlyphBuf
+	for _, tt := range []struct {
+		r    rune
+		kept bool
+	}{{'a', true}, {'b', false}} {
+		if err := g.Load(ft, fixed.I(FontSizeBase), ft.Index(tt.r), font.HintingNone); err != nil {
+			t.Fatal(err)
+		}
+		if kept := len(g.Points) > 0; kept != tt.kept {
+			t.Errorf("glyph of %q is kept: %t, want %t", tt.r, kept, tt.kept)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package germanium
+
+import (
+	"fmt"
+	"math"
+)
+
+// scaled holds the metrics of the panel multiplied by its scale, in pixels
+// of the image
+type scaled struct {
+	layout Layout
+	window WindowStyle
+	shadow Shadow
+	// radius is the margin around the window rectangle taken by its
+	// corners
+	radius int
+	// corner is the radius of the corners of the window
+	corner int
+	// codeOffset is the distance from the top of the window to the source
+	// code
+	codeOffset int
+	// stroke is the width of the strokes of the glyphs on the window
+	// buttons
+	stroke float64
+}
+
+// scalePixels multiplies the length in pixels by the scale
+func scalePixels(n int, s float64) int {
+	return int(math.Round(float64(n) * s))
+}
+
+// scale returns the layout whose paddings are multiplied by s
+func (l Layout) scale(s float64) Layout {
+	l.PaddingX = scalePixels(l.PaddingX, s)
+	l.PaddingY = scalePixels(l.PaddingY, s)
+	l.InnerPadding = scalePixels(l.InnerPadding, s)
+	return l
+}
+
+// scale returns the window style whose bar and buttons are multiplied by s
+func (w WindowStyle) scale(s float64) WindowStyle {
+	w.BarHeight = scalePixels(w.BarHeight, s)
+	buttons := make([]WindowButton, len(w.Buttons))
+	for i, b := range w.Buttons {
+		b.X = scalePixels(b.X, s)
+		b.Size = scalePixels(b.Size, s)
+		buttons[i] = b
+	}
+	w.Buttons = buttons
+	return w
+}
+
+// scale returns the shadow whose blur, offsets and spread are multiplied by s
+func (sh Shadow) scale(s float64) Shadow {
+	sh.Blur = scalePixels(sh.Blur, s)
+	sh.OffsetX = scalePixels(sh.OffsetX, s)
+	sh.OffsetY = scalePixels(sh.OffsetY, s)
+	sh.Spread = scalePixels(sh.Spread, s)
+	return sh
+}
+
+// scaled returns the metrics of the panel in pixels of the image
+func (p *Panel) scaled() scaled {
+	px := scaled{
+		layout:     p.metrics.scale(p.scale),
+		window:     p.windowStyle.scale(p.scale),
+		shadow:     p.shadow.scale(p.scale),
+		radius:     scalePixels(radius, p.scale),
+		corner:     scalePixels(p.cornerRadius, p.scale),
+		codeOffset: scalePixels(windowHeightNoBar, p.scale),
+		stroke:     p.scale,
+	}
+	if px.codeOffset < px.window.BarHeight {
+		px.codeOffset = px.window.BarHeight
+	}
+	return px
+}
+
+// SetScale multiplies the layout, the window chrome and the strokes of its
+// glyphs, the shadow and the tiles of the background image by the scale
+// for HiDPI displays. The font size and the faces of the panel are given in
+// pixels of the image, so they must be multiplied by the scale beforehand,
+// as WithScale does.
+func (p *Panel) SetScale(s float64) error {
+	if s <= 0 {
+		return fmt.Errorf("invalid scale: %g", s)
+	}
+
+	p.scale = s
+	return nil
+}
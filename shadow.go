@@ -0,0 +1,201 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// DefaultShadowColor is the shadow color used when Shadow.Color is empty
+const DefaultShadowColor = "#00000080"
+
+// Shadow holds the configuration of the drop shadow drawn behind the window
+type Shadow struct {
+	// Blur is the blur radius in pixels, twice the standard deviation of
+	// the gaussian blur
+	Blur int
+	// OffsetX and OffsetY move the shadow from the window
+	OffsetX int
+	OffsetY int
+	// Spread grows the shadow shape before blurring
+	Spread int
+	// Color is a hex color with optional alpha eg. '#00000080'
+	Color string
+}
+
+// validate reports an error if the shadow cannot be drawn
+func (s Shadow) validate() error {
+	if s.Blur < 0 || s.Spread < 0 {
+		return fmt.Errorf("invalid shadow: blur %d, spread %d", s.Blur, s.Spread)
+	}
+	if _, err := s.color(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetShadow sets the drop shadow drawn behind the window, which is not
+// drawn by default
+func (p *Panel) SetShadow(s Shadow) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	p.shadow = s
+	return nil
+}
+
+// enabled reports whether the shadow is drawn
+func (s Shadow) enabled() bool {
+	return s.Blur > 0 || s.Spread > 0 || s.OffsetX != 0 || s.OffsetY != 0
+}
+
+// extent returns how far the shadow reaches beyond the window edges
+func (s Shadow) extent() int {
+	return s.Spread + int(math.Ceil(3*s.sigma()))
+}
+
+// sigma returns the standard deviation of the gaussian blur
+func (s Shadow) sigma() float64 {
+	return float64(s.Blur) / 2
+}
+
+// margin returns the room to add to each side of the canvas so that the
+// shadow is not clipped
+func (s Shadow) margin(l Layout) (left, top, right, bottom int) {
+	if !s.enabled() {
+		return
+	}
+
+	grow := func(reach, room int) int {
+		if reach > room {
+			return reach - room
+		}
+		return 0
+	}
+
+	roomX, roomY := l.PaddingX, l.PaddingY
+
+	e := s.extent()
+	return grow(e-s.OffsetX, roomX), grow(e-s.OffsetY, roomY), grow(e+s.OffsetX, roomX), grow(e+s.OffsetY, roomY)
+}
+
+func (s Shadow) color() (color.NRGBA, error) {
+	code := s.Color
+	if code == "" {
+		code = DefaultShadowColor
+	}
+
+	return parseColor(code)
+}
+
+// drawShadow composites the blurred shadow of the window over the background
+func (p *Panel) drawShadow() error {
+	if !p.px.shadow.enabled() {
+		return nil
+	}
+
+	c, err := p.px.shadow.color()
+	if err != nil {
+		return err
+	}
+
+	shape, r := p.shadowShape()
+	mask := image.NewAlpha(p.img.Bounds())
+	fillRoundedRect(mask, shape, r)
+	gaussianBlur(mask, p.px.shadow.sigma())
+
+	draw.DrawMask(p.img, p.img.Bounds(), image.NewUniform(c), image.Point{}, mask, image.Point{}, draw.Over)
+
+	return nil
+}
+
+// svgShadow returns the SVG markup of the shadow
+func (p *Panel) svgShadow() (string, error) {
+	if !p.px.shadow.enabled() {
+		return "", nil
+	}
+
+	c, err := p.px.shadow.color()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	filter := ""
+	if p.px.shadow.Blur > 0 {
+		fmt.Fprintf(&b, `<filter id="shadow" x="-50%%" y="-50%%" width="200%%" height="200%%"><feGaussianBlur stdDeviation="%g"/></filter>`+"\n", p.px.shadow.sigma())
+		filter = ` filter="url(#shadow)"`
+	}
+
+	shape, r := p.shadowShape()
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s"%s/>`+"\n",
+		shape.Min.X, shape.Min.Y, shape.Dx(), shape.Dy(), r, svgColor(c), filter)
+
+	return b.String(), nil
+}
+
+// shadowShape returns the rectangle of the shadow and the radius of its
+// corners, which are square under the square corners of the window
+func (p *Panel) shadowShape() (image.Rectangle, int) {
+	s := p.px.shadow
+	shape := p.window.Inset(-p.px.radius - s.Spread).Add(image.Point{X: s.OffsetX, Y: s.OffsetY})
+	r := p.px.corner
+	if r > 0 {
+		r += s.Spread
+	}
+	return shape, r
+}
+
+// gaussianBlur blurs mask in place with a separable gaussian kernel
+func gaussianBlur(mask *image.Alpha, sigma float64) {
+	if sigma <= 0 {
+		return
+	}
+
+	size := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*size+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - size)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	b := mask.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tmp := make([]float64, w*h)
+
+	// horizontal pass
+	for y := 0; y < h; y++ {
+		row := mask.Pix[y*mask.Stride:]
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				if sx := x + k - size; sx >= 0 && sx < w {
+					v += float64(row[sx]) * weight
+				}
+			}
+			tmp[y*w+x] = v
+		}
+	}
+
+	// vertical pass
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			for k, weight := range kernel {
+				if sy := y + k - size; sy >= 0 && sy < h {
+					v += tmp[sy*w+x] * weight
+				}
+			}
+			mask.Pix[y*mask.Stride+x] = uint8(math.Min(255, math.Round(v)))
+		}
+	}
+}
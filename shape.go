@@ -0,0 +1,116 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"golang.org/x/image/vector"
+)
+
+// kappa is the distance of the control points of the cubic Bézier curve
+// approximating a quarter circle of radius 1
+const kappa = 0.5522847498
+
+// shape adds a closed path to the rasterizer, whose origin is at the point
+// of the image
+type shape func(z *vector.Rasterizer, origin image.Point)
+
+// roundedRect returns the shape of the rectangle with the corners of radius r,
+// which is limited to the half of the shorter side
+func roundedRect(rect image.Rectangle, r int) shape {
+	if r > rect.Dx()/2 {
+		r = rect.Dx() / 2
+	}
+	if r > rect.Dy()/2 {
+		r = rect.Dy() / 2
+	}
+	return func(z *vector.Rasterizer, origin image.Point) {
+		x0, y0 := float32(rect.Min.X-origin.X), float32(rect.Min.Y-origin.Y)
+		x1, y1 := float32(rect.Max.X-origin.X), float32(rect.Max.Y-origin.Y)
+		if r <= 0 {
+			z.MoveTo(x0, y0)
+			z.LineTo(x1, y0)
+			z.LineTo(x1, y1)
+			z.LineTo(x0, y1)
+			z.ClosePath()
+			return
+		}
+
+		rf := float32(r)
+		k := rf * (1 - kappa)
+		z.MoveTo(x0+rf, y0)
+		z.LineTo(x1-rf, y0)
+		z.CubeTo(x1-k, y0, x1, y0+k, x1, y0+rf)
+		z.LineTo(x1, y1-rf)
+		z.CubeTo(x1, y1-k, x1-k, y1, x1-rf, y1)
+		z.LineTo(x0+rf, y1)
+		z.CubeTo(x0+k, y1, x0, y1-k, x0, y1-rf)
+		z.LineTo(x0, y0+rf)
+		z.CubeTo(x0, y0+k, x0+k, y0, x0+rf, y0)
+		z.ClosePath()
+	}
+}
+
+// circle returns the shape of the circle of radius r around the center
+func circle(center image.Point, r int) shape {
+	return func(z *vector.Rasterizer, origin image.Point) {
+		cx, cy := float32(center.X-origin.X), float32(center.Y-origin.Y)
+		rf := float32(r)
+		k := rf * kappa
+		z.MoveTo(cx+rf, cy)
+		z.CubeTo(cx+rf, cy+k, cx+k, cy+rf, cx, cy+rf)
+		z.CubeTo(cx-k, cy+rf, cx-rf, cy+k, cx-rf, cy)
+		z.CubeTo(cx-rf, cy-k, cx-k, cy-rf, cx, cy-rf)
+		z.CubeTo(cx+k, cy-rf, cx+rf, cy-k, cx+rf, cy)
+		z.ClosePath()
+	}
+}
+
+// addLine adds the rectangle of the line of the width between the points,
+// extended by the half of the width beyond them
+func addLine(z *vector.Rasterizer, x0, y0, x1, y1, width float32) {
+	length := float32(math.Hypot(float64(x1-x0), float64(y1-y0)))
+	if length == 0 {
+		return
+	}
+	// the vectors of the half width along and across the line
+	ux, uy := (x1-x0)/length*width/2, (y1-y0)/length*width/2
+	x0, y0, x1, y1 = x0-ux, y0-uy, x1+ux, y1+uy
+	z.MoveTo(x0+uy, y0-ux)
+	z.LineTo(x1+uy, y1-ux)
+	z.LineTo(x1-uy, y1+ux)
+	z.LineTo(x0-uy, y0+ux)
+	z.ClosePath()
+}
+
+// fillShape draws the shape anti-aliased in the color over dst, inside the
+// clip rectangle
+func fillShape(dst draw.Image, s shape, c color.Color, clip image.Rectangle) {
+	clip = clip.Intersect(dst.Bounds())
+	if clip.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(clip.Dx(), clip.Dy())
+	s(z, clip.Min)
+	z.Draw(dst, clip, image.NewUniform(c), image.Point{})
+}
+
+// fillRoundedRect fills the rectangle with rounded corners of radius r on mask
+func fillRoundedRect(mask *image.Alpha, rect image.Rectangle, r int) {
+	fillShape(mask, roundedRect(rect, r), color.Opaque, rect)
+}
+
+// SetCornerRadius sets the radius of the corners of the window in pixels,
+// which are square if the radius is 0
+func (p *Panel) SetCornerRadius(r int) error {
+	if r < 0 {
+		return fmt.Errorf("invalid corner radius: %d", r)
+	}
+
+	p.cornerRadius = r
+	return nil
+}
@@ -0,0 +1,97 @@
+package germanium
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFillRoundedRect(t *testing.T) {
+	rect := image.Rect(10, 10, 90, 70)
+
+	tests := []struct {
+		radius int
+		// alpha of the corner pixel
+		corner func(a uint8) bool
+	}{
+		{radius: 0, corner: func(a uint8) bool { return a == 0xff }},
+		{radius: 20, corner: func(a uint8) bool { return a == 0 }},
+		// the radius is limited to the half of the height
+		{radius: 100, corner: func(a uint8) bool { return a == 0 }},
+	}
+
+	for _, tt := range tests {
+		mask := image.NewAlpha(image.Rect(0, 0, 100, 80))
+		fillRoundedRect(mask, rect, tt.radius)
+
+		if a := mask.AlphaAt(rect.Min.X, rect.Min.Y).A; !tt.corner(a) {
+			t.Errorf("radius %d: alpha of the corner = %d", tt.radius, a)
+		}
+		if a := mask.AlphaAt(50, 40).A; a != 0xff {
+			t.Errorf("radius %d: alpha of the center = %d, want 255", tt.radius, a)
+		}
+		if a := mask.AlphaAt(rect.Min.X-1, 40).A; a != 0 {
+			t.Errorf("radius %d: alpha outside = %d, want 0", tt.radius, a)
+		}
+
+		// the rounded edge is anti-aliased with partially covered pixels
+		partial := 0
+		for _, a := range mask.Pix {
+			if a != 0 && a != 0xff {
+				partial++
+			}
+		}
+		if tt.radius == 0 && partial != 0 {
+			t.Errorf("radius 0: %d partially covered pixels, want 0", partial)
+		}
+		if tt.radius > 0 && partial == 0 {
+			t.Errorf("radius %d: no partially covered pixels", tt.radius)
+		}
+	}
+}
+
+func TestSetCornerRadius(t *testing.T) {
+	p := NewPanel(0, 0, 10, 10)
+	if err := p.SetCornerRadius(-1); err == nil {
+		t.Errorf("negative radius is accepted")
+	}
+}
+
+func TestGlyphShape(t *testing.T) {
+	center := image.Pt(20, 20)
+
+	for _, width := range []float64{1, 2, 3} {
+		// the minimize glyph is a sharp line of the width
+		mask := image.NewAlpha(image.Rect(0, 0, 40, 40))
+		fillShape(mask, glyphShape(GlyphMinimize, center, 5, width), color.Opaque, mask.Rect)
+		rows := 0
+		for y := 0; y < 40; y++ {
+			switch a := mask.AlphaAt(20, y).A; a {
+			case 0xff:
+				rows++
+			case 0:
+			default:
+				t.Errorf("width %g: alpha at row %d = %d, want 0 or 255", width, y, a)
+			}
+		}
+		if rows != int(width) {
+			t.Errorf("width %g: %d rows, want %d", width, rows, int(width))
+		}
+
+		// the close glyph is anti-aliased, and crosses at the center
+		mask = image.NewAlpha(image.Rect(0, 0, 40, 40))
+		fillShape(mask, glyphShape(GlyphClose, center, 5, width), color.Opaque, mask.Rect)
+		if a := mask.AlphaAt(center.X, center.Y).A; a == 0 {
+			t.Errorf("width %g: close glyph misses the center", width)
+		}
+		partial := 0
+		for _, a := range mask.Pix {
+			if a != 0 && a != 0xff {
+				partial++
+			}
+		}
+		if partial == 0 {
+			t.Errorf("width %g: close glyph is not anti-aliased", width)
+		}
+	}
+}
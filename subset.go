@@ -0,0 +1,236 @@
+package germanium
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// composite glyph flags
+const (
+	argsAreWords    = 0x0001
+	haveScale       = 0x0008
+	moreComponents  = 0x0020
+	haveXYScale     = 0x0040
+	haveTwoByTwo    = 0x0080
+	sfntHeaderSize  = 12
+	tableRecordSize = 16
+)
+
+type sfntTable struct {
+	tag  string
+	data []byte
+}
+
+// SubsetFont returns a copy of the TrueType font data that only keeps the
+// outlines of the glyphs needed to draw text. Glyph IDs are retained, so the
+// cmap and metrics tables are kept as is and unused glyphs become empty.
+func SubsetFont(data []byte, text string) ([]byte, error) {
+	ft, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := readTables(data)
+	if err != nil {
+		return nil, err
+	}
+	head, loca, glyf := findTable(tables, "head"), findTable(tables, "loca"), findTable(tables, "glyf")
+	if head == nil || loca == nil || glyf == nil || len(head.data) < 54 {
+		return nil, fmt.Errorf("font has no TrueType outlines")
+	}
+	longLoca := binary.BigEndian.Uint16(head.data[50:]) != 0
+
+	offsets := parseLoca(loca.data, longLoca)
+	if len(offsets) < 2 {
+		return nil, fmt.Errorf("invalid loca table")
+	}
+
+	used := map[int]bool{0: true} // .notdef is always kept
+	for _, r := range text {
+		addGlyph(used, int(ft.Index(r)), offsets, glyf.data)
+	}
+
+	var newGlyf []byte
+	newOffsets := make([]uint32, len(offsets))
+	for i := 0; i < len(offsets)-1; i++ {
+		newOffsets[i] = uint32(len(newGlyf))
+		if !used[i] {
+			continue
+		}
+		start, end := offsets[i], offsets[i+1]
+		if start > end || int(end) > len(glyf.data) {
+			return nil, fmt.Errorf("invalid glyph offset: %d", i)
+		}
+		newGlyf = append(newGlyf, glyf.data[start:end]...)
+		for len(newGlyf)%4 != 0 {
+			newGlyf = append(newGlyf, 0)
+		}
+	}
+	newOffsets[len(offsets)-1] = uint32(len(newGlyf))
+
+	glyf.data = newGlyf
+	loca.data = writeLoca(newOffsets, longLoca)
+
+	return writeTables(tables), nil
+}
+
+func addGlyph(used map[int]bool, gid int, offsets []uint32, glyf []byte) {
+	if used[gid] || gid+1 >= len(offsets) {
+		return
+	}
+	used[gid] = true
+
+	start, end := offsets[gid], offsets[gid+1]
+	if end-start < 10 || int(end) > len(glyf) {
+		return
+	}
+	g := glyf[start:end]
+	if int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return // simple glyph
+	}
+
+	// composite glyph, keep its components as well
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		addGlyph(used, int(binary.BigEndian.Uint16(g[p+2:])), offsets, glyf)
+		p += 4
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+}
+
+func readTables(data []byte) ([]*sfntTable, error) {
+	if len(data) < sfntHeaderSize {
+		return nil, fmt.Errorf("invalid font data")
+	}
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < sfntHeaderSize+n*tableRecordSize {
+		return nil, fmt.Errorf("invalid font data")
+	}
+
+	tables := make([]*sfntTable, 0, n)
+	for i := 0; i < n; i++ {
+		rec := data[sfntHeaderSize+i*tableRecordSize:]
+		offset := binary.BigEndian.Uint32(rec[8:])
+		length := binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid table: %s", rec[:4])
+		}
+		tables = append(tables, &sfntTable{
+			tag:  string(rec[:4]),
+			data: append([]byte(nil), data[offset:offset+length]...),
+		})
+	}
+
+	return tables, nil
+}
+
+func writeTables(tables []*sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	out := make([]byte, sfntHeaderSize+n*tableRecordSize)
+	binary.BigEndian.PutUint32(out[0:], 0x00010000)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(n*16-searchRange))
+
+	headOffset := -1
+	for i, t := range tables {
+		if t.tag == "head" {
+			// checkSumAdjustment must be zero while calculating checksums
+			binary.BigEndian.PutUint32(t.data[8:], 0)
+			headOffset = len(out)
+		}
+
+		rec := out[sfntHeaderSize+i*tableRecordSize:]
+		copy(rec, t.tag)
+		binary.BigEndian.PutUint32(rec[4:], checksum(t.data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t.data)))
+
+		out = append(out, t.data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-checksum(out))
+	}
+
+	return out
+}
+
+func findTable(tables []*sfntTable, tag string) *sfntTable {
+	for _, t := range tables {
+		if t.tag == tag {
+			return t
+		}
+	}
+	return nil
+}
+
+func parseLoca(data []byte, long bool) []uint32 {
+	var offsets []uint32
+	if long {
+		for i := 0; i+4 <= len(data); i += 4 {
+			offsets = append(offsets, binary.BigEndian.Uint32(data[i:]))
+		}
+	} else {
+		for i := 0; i+2 <= len(data); i += 2 {
+			offsets = append(offsets, uint32(binary.BigEndian.Uint16(data[i:]))*2)
+		}
+	}
+	return offsets
+}
+
+func writeLoca(offsets []uint32, long bool) []byte {
+	if long {
+		b := make([]byte, len(offsets)*4)
+		for i, o := range offsets {
+			binary.BigEndian.PutUint32(b[i*4:], o)
+		}
+		return b
+	}
+
+	b := make([]byte, len(offsets)*2)
+	for i, o := range offsets {
+		binary.BigEndian.PutUint16(b[i*2:], uint16(o/2))
+	}
+	return b
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
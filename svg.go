@@ -0,0 +1,257 @@
+package germanium
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"golang.org/x/image/font"
+)
+
+const defaultSVGFontFamily = "monospace"
+
+var svgEscaper = strings.NewReplacer(
+	`&`, "&amp;",
+	`<`, "&lt;",
+	`>`, "&gt;",
+	`"`, "&quot;",
+)
+
+// SVGFormatter is a formatter for SVG
+type SVGFormatter struct {
+	fontSize    float64
+	face        font.Face
+	fontFamily  string
+	fontData    []byte
+	startPoint  image.Point
+	hasLineNum  bool
+	highlight   *lineHighlight
+	firstLine   int
+	diff        *Diff
+	window      image.Rectangle
+	size        image.Point
+	chrome      string
+	widthMode   string
+	lineSpacing float64
+}
+
+// NewSVGFormatter generates a new SVG formatter. chrome is the SVG markup of
+// the window drawn under the source code on a canvas of the given size.
+func NewSVGFormatter(fs float64, face font.Face, sp image.Point, l bool, size image.Point, chrome string) *SVGFormatter {
+	return &SVGFormatter{
+		fontSize:    fs,
+		face:        face,
+		fontFamily:  defaultSVGFontFamily,
+		startPoint:  sp,
+		hasLineNum:  l,
+		firstLine:   1,
+		size:        size,
+		chrome:      chrome,
+		widthMode:   WidthGlyph,
+		lineSpacing: DefaultLayout.LineSpacing,
+	}
+}
+
+// Format formats the source code as SVG
+func (f *SVGFormatter) Format(w io.Writer, style *chroma.Style, iterator chroma.Iterator) error {
+	return f.format(w, style, iterator.Tokens())
+}
+
+func (f *SVGFormatter) format(w io.Writer, style *chroma.Style, tokens []chroma.Token) error {
+	lines := chroma.SplitTokensIntoLines(tokens)
+	digits := len(strconv.Itoa(f.firstLine + len(lines) - 1))
+	format := fmt.Sprintf("%%%dd", digits+1)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", f.size.X, f.size.Y, f.size.X, f.size.Y)
+
+	if len(f.fontData) > 0 {
+		families := strings.Split(f.fontFamily, ",")
+		fmt.Fprintf(&b, "<style>@font-face { font-family: '%s'; src: url(data:font/ttf;base64,%s) format('truetype'); }</style>\n",
+			svgEscaper.Replace(strings.TrimSpace(families[0])), base64.StdEncoding.EncodeToString(f.fontData))
+	}
+
+	b.WriteString(f.chrome)
+
+	fmt.Fprintf(&b, `<g font-family="%s" font-size="%dpx" xml:space="preserve">`+"\n", svgFontFamily(f.fontFamily), int(f.fontSize))
+
+	space := font.MeasureString(f.face, " ").Round()
+	left := f.startPoint.X
+	y := f.startPoint.Y
+
+	gutter := 0
+	if f.diff != nil {
+		gutter = f.diff.gutterWidth(f.hasLineNum)
+	} else if f.hasLineNum {
+		gutter = digits + 1
+	}
+	sx := left + space + space*gutter
+
+	metrics := f.face.Metrics()
+	fg := chooseColorBasedOnContrast(windowBackground(style))
+	lineHeight := int(f.fontSize * f.lineSpacing)
+
+	for i, tokens := range lines {
+		if i == 0 {
+			y += int(f.fontSize)
+		} else {
+			y += lineHeight
+		}
+
+		if f.highlight != nil && f.highlight.contains(f.firstLine+i) {
+			band := f.highlight.band(y, metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", band.Min.X, band.Min.Y, band.Dx(), band.Dy(), svgColor(f.highlight.color))
+		}
+
+		if f.diff != nil {
+			if bg, ok := f.diff.background(i); ok {
+				band := lineBand(f.window.Min.X, f.window.Max.X, y, metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", band.Min.X, band.Min.Y, band.Dx(), band.Dy(), svgColor(bg))
+			}
+
+			numbers, marker := f.diff.gutter(i, f.hasLineNum)
+			fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s">%s<tspan fill="%s">%s</tspan></text>`+"\n",
+				left, y, svgColor(fg), numbers, svgColor(f.diff.markerColor(i, fg)), marker)
+
+			if f.diff.Lines[i].Kind == DiffHunk {
+				fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n",
+					sx, y, svgColor(tokenColor(style, chroma.GenericSubheading)), svgEscaper.Replace(f.diff.Lines[i].Text))
+				continue
+			}
+		} else if f.hasLineNum {
+			fmt.Fprintf(&b, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n", left, y, svgColor(f.highlight.dim(fg, f.firstLine+i)), fmt.Sprintf(format, f.firstLine+i))
+		}
+
+		// token backgrounds go under the text
+		x := sx
+		for _, t := range tokens {
+			width := textWidth(f.face, t.Value, f.widthMode).Round()
+			if bg, ok := tokenBackground(style, style.Get(t.Type)); ok {
+				band := lineBand(x, x+width, y, metrics.Ascent.Round(), metrics.Descent.Round(), lineHeight)
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", band.Min.X, band.Min.Y, band.Dx(), band.Dy(), svgColor(bg))
+			}
+			x += width
+		}
+
+		fmt.Fprintf(&b, `<text x="%d" y="%d">`, sx, y)
+		for _, t := range tokens {
+			text := strings.ReplaceAll(strings.TrimRight(t.Value, "\n"), "\t", "    ")
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<tspan fill="%s"%s>%s</tspan>`, svgColor(f.highlight.dim(tokenColor(style, t.Type), f.firstLine+i)), svgFontStyle(style.Get(t.Type)), svgEscaper.Replace(text))
+		}
+		b.WriteString("</text>\n")
+	}
+
+	b.WriteString("</g>\n</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// svgWindow returns the SVG markup of the background, the window, its
+// control buttons and the title for the file, which Panel.Draw draws for PNG
+// output
+func (p *Panel) svgWindow(filename string) (string, error) {
+	bg, err := p.backgroundColor()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`+"\n", p.img.Rect.Dx(), p.img.Rect.Dy(), svgColor(bg))
+
+	background, err := p.svgBackground()
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(background)
+
+	shadow, err := p.svgShadow()
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(shadow)
+
+	w := p.window.Inset(-p.px.radius)
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d" fill="%s"/>`+"\n",
+		w.Min.X, w.Min.Y, w.Dx(), w.Dy(), p.px.corner, svgColor(p.windowColor))
+
+	b.WriteString(p.svgWindowBar())
+
+	title, err := p.svgTitle(filename)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(title)
+
+	return b.String(), nil
+}
+
+// svgGlyphs returns the characters drawn with the font of the SVG, which
+// are kept in the embedded font: the rendered lines, the title, the line
+// numbers and the diff gutters
+func (p *Panel) svgGlyphs(tokens []chroma.Token, filename string) string {
+	var b strings.Builder
+	b.WriteString("0123456789 +-")
+	b.WriteString(p.titleText(filename))
+	for _, t := range tokens {
+		b.WriteString(t.Value)
+	}
+	if p.diff != nil {
+		for _, l := range p.diff.Lines {
+			if l.Kind == DiffHunk {
+				b.WriteString(l.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// svgFontFamily returns the font-family attribute of the comma separated
+// list of fonts, falling back to monospace
+func svgFontFamily(family string) string {
+	if family == defaultSVGFontFamily {
+		return family
+	}
+
+	var quoted []string
+	for _, name := range strings.Split(family, ",") {
+		quoted = append(quoted, fmt.Sprintf("'%s'", svgEscaper.Replace(strings.TrimSpace(name))))
+	}
+	return strings.Join(append(quoted, defaultSVGFontFamily), ", ")
+}
+
+// svgFontStyle returns the attributes of the font style of the style entry
+func svgFontStyle(entry chroma.StyleEntry) string {
+	var attrs string
+	if entry.Bold == chroma.Yes {
+		attrs += ` font-weight="bold"`
+	}
+	if entry.Italic == chroma.Yes {
+		attrs += ` font-style="italic"`
+	}
+	if entry.Underline == chroma.Yes {
+		attrs += ` text-decoration="underline"`
+	}
+	return attrs
+}
+
+// svgColor converts color into SVG color notation
+func svgColor(c color.Color) string {
+	r, g, b, a := c.RGBA()
+	if a == 0xffff {
+		return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+	}
+	if a == 0 {
+		return "none"
+	}
+	// color.RGBA() is alpha-premultiplied
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3f)", r*255/a, g*255/a, b*255/a, float64(a)/0xffff)
+}
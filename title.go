@@ -0,0 +1,134 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// TitleFontScale is the size of the title relative to the source code
+const TitleFontScale = 0.75
+
+// Title is the text centered in the window access bar
+type Title struct {
+	Text string
+	// Filename uses the base name of the file passed to Label when Text is empty
+	Filename bool
+	// Color of the text, a contrast color of the window background if empty
+	Color string
+	// Face draws the text at FontSize, the face of the source code if nil
+	Face     font.Face
+	FontSize float64
+}
+
+// SetTitle sets the title drawn in the window access bar
+func (p *Panel) SetTitle(t Title) {
+	p.title = t
+}
+
+// titleText returns the title for the file, truncated to fit between the
+// control buttons
+func (p *Panel) titleText(filename string) string {
+	text := p.title.Text
+	if text == "" && p.title.Filename && filename != "" && filename != "-" {
+		text = filepath.Base(filename)
+	}
+	if text == "" || p.px.window.BarHeight == 0 {
+		return ""
+	}
+
+	// keep the room for the control buttons on both sides
+	face := p.titleFace()
+	room := fixed.I(p.px.window.bar(p.window, p.px.radius).Dx() - p.px.window.buttonsMargin(p.px.radius)*2)
+	if font.MeasureString(face, text) <= room {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if t := string(runes) + "…"; font.MeasureString(face, t) <= room {
+			return t
+		}
+	}
+	return ""
+}
+
+// titleFace returns the face drawing the title
+func (p *Panel) titleFace() font.Face {
+	if p.title.Face != nil {
+		return p.title.Face
+	}
+	return p.fontFace
+}
+
+// titleFontSize returns the font size of the title
+func (p *Panel) titleFontSize() float64 {
+	if p.title.Face != nil && p.title.FontSize > 0 {
+		return p.title.FontSize
+	}
+	return p.fontSize
+}
+
+// titleColor returns the color of the title
+func (p *Panel) titleColor() (color.Color, error) {
+	if p.title.Color == "" {
+		return chooseColorBasedOnContrast(p.windowColor), nil
+	}
+	return parseColor(p.title.Color)
+}
+
+// titleBaseline returns the baseline of the title vertically centered in
+// the access bar
+func (p *Panel) titleBaseline(face font.Face) int {
+	m := face.Metrics()
+	bar := p.px.window.bar(p.window, p.px.radius)
+	return bar.Min.Y + bar.Dy()/2 + (m.Ascent.Round()-m.Descent.Round())/2
+}
+
+// drawTitle draws the title for the file in the access bar
+func (p *Panel) drawTitle(filename string) error {
+	// the color is checked even if the title does not fit
+	c, err := p.titleColor()
+	if err != nil {
+		return err
+	}
+
+	text := p.titleText(filename)
+	if text == "" {
+		return nil
+	}
+
+	face := p.titleFace()
+	d := &font.Drawer{
+		Dst:  p.img,
+		Src:  image.NewUniform(c),
+		Face: face,
+	}
+	width := d.MeasureString(text)
+	center := fixed.I(p.window.Min.X + p.window.Dx()/2)
+	d.Dot = fixed.Point26_6{X: center - width/2, Y: fixed.I(p.titleBaseline(face))}
+	d.DrawString(text)
+
+	return nil
+}
+
+// svgTitle returns the SVG markup of the title for the file
+func (p *Panel) svgTitle(filename string) (string, error) {
+	c, err := p.titleColor()
+	if err != nil {
+		return "", err
+	}
+
+	text := p.titleText(filename)
+	if text == "" {
+		return "", nil
+	}
+
+	return fmt.Sprintf(`<text x="%d" y="%d" font-family="%s" font-size="%dpx" text-anchor="middle" fill="%s" xml:space="preserve">%s</text>`+"\n",
+		p.window.Min.X+p.window.Dx()/2, p.titleBaseline(p.titleFace()), svgFontFamily(p.fontFamily), int(p.titleFontSize()), svgColor(c), svgEscaper.Replace(text)), nil
+}
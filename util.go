@@ -25,7 +25,7 @@ func ParseHexColor(s string) (color.RGBA, error) {
 	var err error
 
 	// Remove hash if present
-	if s[0] == '#' {
+	if len(s) > 0 && s[0] == '#' {
 		s = s[1:]
 	}
 
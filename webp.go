@@ -0,0 +1,848 @@
+package germanium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// maxWebPSize is the limit of the width and the height of WebP images
+	maxWebPSize = 1 << 14
+
+	// the alphabets of the prefix codes besides the color cache
+	vp8lLiterals      = 256
+	vp8lLengthCodes   = 24
+	vp8lDistanceCodes = 40
+	vp8lCodeLengths   = 19
+
+	// the limits of the backward references
+	vp8lMinMatch    = 3
+	vp8lMaxMatch    = 4096
+	vp8lMaxDistance = 1<<20 - 120
+
+	// vp8lHashBits is the size of the hash table of the pixel pairs, and
+	// vp8lChainLength is the number of the earlier positions of a pair
+	// tried for a backward reference
+	vp8lHashBits    = 16
+	vp8lChainLength = 32
+
+	// vp8lPredictorBits is the log2 size of the tiles sharing a predictor
+	vp8lPredictorBits = 4
+
+	// colorCacheMultiplier hashes the pixels into the color cache
+	colorCacheMultiplier = 0x1e35a7bd
+)
+
+// the transforms of VP8L written by the encoder
+const (
+	vp8lPredictorTransform     = 0
+	vp8lSubtractGreenTransform = 2
+)
+
+// vp8lCacheBits are the sizes of the color cache tried for an image, 0 for
+// no color cache
+var vp8lCacheBits = []int{0, 4, 6, 8, 10}
+
+// predictorModes are the modes of the predictor in the order they are tried,
+// the left and upper pixels first as they predict the flat colors
+var predictorModes = []int{1, 2, 0, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}
+
+// codeLengthCodeOrder is the order of the code lengths of the code of the
+// code lengths
+var codeLengthCodeOrder = [vp8lCodeLengths]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// distanceMapTable is the offsets of the distance codes 1 to 120 to the
+// neighbors of the pixel, y<<4 | 8-x
+var distanceMapTable = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// encodeWebP encodes the image in lossless WebP. The pixels are compressed
+// by the backward references of LZ77, the color cache and the prefix codes
+// of the symbols, after subtracting green and optionally predicting them
+// from their neighbors. The prediction suits the photos and the gradients,
+// but not the text, so the image is encoded with and without it, and the
+// smaller one is written.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > maxWebPSize || height > maxWebPSize {
+		return fmt.Errorf("invalid size for WebP: %dx%d", width, height)
+	}
+
+	argb, opaque := argbPixels(img)
+	var data []byte
+	for _, transforms := range [][]int{
+		{vp8lSubtractGreenTransform},
+		{vp8lSubtractGreenTransform, vp8lPredictorTransform},
+	} {
+		if d := encodeVP8L(argb, width, height, opaque, transforms); data == nil || len(d) < len(data) {
+			data = d
+		}
+	}
+
+	_, err := w.Write(riffVP8L(data))
+	return err
+}
+
+// riffVP8L returns the WebP file of the VP8L bitstream
+func riffVP8L(data []byte) []byte {
+	var buf bytes.Buffer
+	size := len(data)
+	padded := size + size&1
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+padded))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(&buf, binary.LittleEndian, uint32(size))
+	buf.Write(data)
+	if size&1 == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// argbPixels returns the non-premultiplied pixels of the image in ARGB, and
+// whether they are all opaque
+func argbPixels(img image.Image) ([]uint32, bool) {
+	b := img.Bounds()
+	argb := make([]uint32, 0, b.Dx()*b.Dy())
+	opaque := true
+	rgba, _ := img.(*image.RGBA)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var c color.NRGBA
+			if rgba != nil && rgba.RGBAAt(x, y).A == 0xff {
+				// the opaque colors are the same premultiplied
+				o := rgba.RGBAAt(x, y)
+				c = color.NRGBA{o.R, o.G, o.B, o.A}
+			} else {
+				c = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			}
+			opaque = opaque && c.A == 0xff
+			argb = append(argb, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+		}
+	}
+	return argb, opaque
+}
+
+// encodeVP8L returns the VP8L bitstream of the pixels in ARGB, applying the
+// transforms in order
+func encodeVP8L(argb []uint32, width, height int, opaque bool, transforms []int) []byte {
+	var bw bitWriter
+	bw.writeBits(0x2f, 8) // signature
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if opaque {
+		bw.writeBits(0, 1)
+	} else {
+		bw.writeBits(1, 1)
+	}
+	bw.writeBits(0, 3) // version
+
+	pix := append([]uint32(nil), argb...)
+	for _, t := range transforms {
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(t), 2)
+		switch t {
+		case vp8lSubtractGreenTransform:
+			subtractGreen(pix)
+		case vp8lPredictorTransform:
+			bw.writeBits(vp8lPredictorBits-2, 3)
+			modes := predict(pix, width, height, vp8lPredictorBits)
+			bw.writeImage(modes, tiles(width, vp8lPredictorBits), false)
+		}
+	}
+	bw.writeBits(0, 1) // no more transforms
+
+	bw.writeImage(pix, width, true)
+	return bw.bytes()
+}
+
+// tiles returns the number of the tiles of the log2 size covering n pixels
+func tiles(n int, bits uint) int {
+	return (n + 1<<bits - 1) >> bits
+}
+
+// subtractGreen subtracts the green of each pixel from its red and blue
+func subtractGreen(pix []uint32) {
+	for i, p := range pix {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict replaces the pixels with their differences from the predictions
+// by their left and upper neighbors, and returns the image of the mode of
+// the prediction of each tile. The mode giving the smallest differences is
+// chosen for each tile.
+func predict(pix []uint32, width, height int, bits uint) []uint32 {
+	tilesX, tilesY := tiles(width, bits), tiles(height, bits)
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(pix))
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx<<bits, ty<<bits
+			x1, y1 := minInt(x0+1<<bits, width), minInt(y0+1<<bits, height)
+			// the first row and column have fixed predictions
+			x0, y0 = maxInt(x0, 1), maxInt(y0, 1)
+
+			best, bestCost := 0, -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := y0; y < y1 && (bestCost < 0 || cost < bestCost); y++ {
+					for x := x0; x < x1; x++ {
+						i := y*width + x
+						cost += residualCost(subPixels(pix[i], predictPixel(mode, pix, i, width)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+				if bestCost == 0 {
+					break
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = pix[i-1]
+			case x == 0:
+				pred = pix[i-width]
+			default:
+				mode := int(modes[(y>>bits)*tilesX+x>>bits] >> 8 & 0xf)
+				pred = predictPixel(mode, pix, i, width)
+			}
+			residuals[i] = subPixels(pix[i], pred)
+		}
+	}
+	copy(pix, residuals)
+	return modes
+}
+
+// predictPixel returns the prediction of the pixel i by the mode, from the
+// pixels on its left (L), top left (TL), top (T) and top right (TR)
+func predictPixel(mode int, pix []uint32, i, width int) uint32 {
+	l, t, tr, tl := pix[i-1], pix[i-width], pix[i-width+1], pix[i-width-1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+// argbChannel returns the channel i of the pixel, from blue to alpha
+func argbChannel(p uint32, i int) int {
+	return int(p >> (8 * i) & 0xff)
+}
+
+// clampAddSubtractFull returns a + b - c of each channel clamped to the byte
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for i := 0; i < 4; i++ {
+		p |= clampByte(argbChannel(a, i)+argbChannel(b, i)-argbChannel(c, i)) << (8 * i)
+	}
+	return p
+}
+
+// clampAddSubtractHalf returns a + (a - b) / 2 of each channel clamped to
+// the byte
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for i := 0; i < 4; i++ {
+		p |= clampByte(argbChannel(a, i)+(argbChannel(a, i)-argbChannel(b, i))/2) << (8 * i)
+	}
+	return p
+}
+
+func clampByte(v int) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 0xff {
+		return 0xff
+	}
+	return uint32(v)
+}
+
+// average2 returns the average of each channel of the pixels
+func average2(a, b uint32) uint32 {
+	return (a^b)&0xfefefefe>>1 + a&b
+}
+
+// selectPixel returns the one of L and T closer to the gradient estimate
+// L + T - TL
+func selectPixel(l, t, tl uint32) uint32 {
+	var pl, pt int
+	for i := 0; i < 4; i++ {
+		pl += abs(argbChannel(tl, i) - argbChannel(t, i))
+		pt += abs(argbChannel(tl, i) - argbChannel(l, i))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+// subPixels subtracts each channel of b from a, modulo 256
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	redBlue := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// residualCost estimates the cost of the difference from the prediction
+func residualCost(r uint32) int {
+	return abs(int(int8(r))) + abs(int(int8(r>>8))) + abs(int(int8(r>>16))) + abs(int(int8(r>>24)))
+}
+
+// backwardRef copies the length of pixels from the distance before them,
+// or is the literal of a pixel if the length is 0
+type backwardRef struct {
+	length int
+	dist   int
+}
+
+// backwardRefs returns the backward references of the pixels, which take
+// the longest match at the distance of the left or upper pixel, or of the
+// earlier pixels starting with the same pair
+func backwardRefs(pix []uint32, width int) []backwardRef {
+	n := len(pix)
+	refs := make([]backwardRef, 0, n/4)
+
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (pix[i]*colorCacheMultiplier ^ pix[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	for i := 0; i < n; {
+		maxLen := minInt(n-i, vp8lMaxMatch)
+		bestLen, bestDist := 0, 0
+		try := func(d int) {
+			if d < 1 || d > i {
+				return
+			}
+			l := 0
+			for l < maxLen && pix[i+l] == pix[i-d+l] {
+				l++
+			}
+			if l > bestLen {
+				bestLen, bestDist = l, d
+			}
+		}
+
+		try(1)
+		try(width)
+		if i+1 < n {
+			for j, k := head[hash(i)], 0; j >= 0 && k < vp8lChainLength && bestLen < maxLen; j, k = prev[j], k+1 {
+				d := i - int(j)
+				if d > vp8lMaxDistance {
+					break
+				}
+				try(d)
+			}
+		}
+
+		if bestLen < vp8lMinMatch {
+			refs = append(refs, backwardRef{})
+			insert(i)
+			i++
+			continue
+		}
+		refs = append(refs, backwardRef{length: bestLen, dist: bestDist})
+		for k := 0; k < bestLen; k++ {
+			insert(i + k)
+		}
+		i += bestLen
+	}
+	return refs
+}
+
+// distanceCodes returns the distance codes of the neighbors of a pixel in
+// the image of the width, whose other distances are coded as distance+120
+func distanceCodes(width int) map[int]int {
+	codes := make(map[int]int, len(distanceMapTable))
+	for i, v := range distanceMapTable {
+		d := int(v>>4)*width + 8 - int(v&0xf)
+		if _, ok := codes[d]; d >= 1 && !ok {
+			codes[d] = i + 1
+		}
+	}
+	return codes
+}
+
+// the prefix codes of a group, indexed by the channel of the symbol
+const (
+	codeGreen = iota
+	codeRed
+	codeBlue
+	codeAlpha
+	codeDistance
+	numCodes
+)
+
+// emitSymbols calls emit with the prefix code, the symbol and the extra
+// bits of each symbol of the pixels coded by the backward references and
+// the color cache
+func emitSymbols(pix []uint32, refs []backwardRef, width, cacheBits int, emit func(code, symbol int, extra uint32, n uint)) {
+	var cache []uint32
+	shift := uint(32 - cacheBits)
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	codes := distanceCodes(width)
+
+	i := 0
+	for _, r := range refs {
+		if r.length == 0 {
+			p := pix[i]
+			i++
+			if cache != nil {
+				key := p * colorCacheMultiplier >> shift
+				if cache[key] == p {
+					emit(codeGreen, vp8lLiterals+vp8lLengthCodes+int(key), 0, 0)
+					continue
+				}
+				cache[key] = p
+			}
+			emit(codeGreen, argbChannel(p, 1), 0, 0)
+			emit(codeRed, argbChannel(p, 2), 0, 0)
+			emit(codeBlue, argbChannel(p, 0), 0, 0)
+			emit(codeAlpha, argbChannel(p, 3), 0, 0)
+			continue
+		}
+
+		symbol, extra, n := lz77Prefix(r.length)
+		emit(codeGreen, vp8lLiterals+symbol, extra, n)
+		code, ok := codes[r.dist]
+		if !ok {
+			code = r.dist + len(distanceMapTable)
+		}
+		symbol, extra, n = lz77Prefix(code)
+		emit(codeDistance, symbol, extra, n)
+
+		if cache != nil {
+			for _, p := range pix[i : i+r.length] {
+				cache[p*colorCacheMultiplier>>shift] = p
+			}
+		}
+		i += r.length
+	}
+}
+
+// lz77Prefix returns the prefix symbol and the extra bits of the length or
+// the distance code v
+func lz77Prefix(v int) (symbol int, extra uint32, n uint) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := bits.Len(uint(v)) - 1
+	second := v >> (high - 1) & 1
+	n = uint(high - 1)
+	return 2*high + second, uint32(v & (1<<n - 1)), n
+}
+
+// writeImage writes the entropy coded pixels of the image of the width,
+// with the color cache of the size giving the fewest bits. The top level
+// image is the ARGB image, and the others are the images of the transforms.
+func (w *bitWriter) writeImage(pix []uint32, width int, topLevel bool) {
+	refs := backwardRefs(pix, width)
+
+	var best [numCodes]*prefixCode
+	bestBits, bestSize := 0, -1
+	for _, cacheBits := range vp8lCacheBits {
+		hists := [numCodes][]uint32{
+			make([]uint32, vp8lLiterals+vp8lLengthCodes),
+			make([]uint32, vp8lLiterals),
+			make([]uint32, vp8lLiterals),
+			make([]uint32, vp8lLiterals),
+			make([]uint32, vp8lDistanceCodes),
+		}
+		if cacheBits > 0 {
+			hists[codeGreen] = make([]uint32, vp8lLiterals+vp8lLengthCodes+1<<cacheBits)
+		}
+		emitSymbols(pix, refs, width, cacheBits, func(code, symbol int, _ uint32, _ uint) {
+			hists[code][symbol]++
+		})
+
+		// the size of the prefix codes and the symbols, without the extra
+		// bits which are the same for any color cache
+		var header bitWriter
+		var codes [numCodes]*prefixCode
+		size := 0
+		for i, h := range hists {
+			codes[i] = newPrefixCode(h, 15)
+			header.writePrefixCode(codes[i])
+			size += codes[i].size(h)
+		}
+		size += header.len()
+
+		if bestSize < 0 || size < bestSize {
+			best, bestBits, bestSize = codes, cacheBits, size
+		}
+	}
+
+	if bestBits > 0 {
+		w.writeBits(1, 1)
+		w.writeBits(uint32(bestBits), 4)
+	} else {
+		w.writeBits(0, 1)
+	}
+	if topLevel {
+		w.writeBits(0, 1) // no meta prefix codes
+	}
+	for _, c := range best {
+		w.writePrefixCode(c)
+	}
+	emitSymbols(pix, refs, width, bestBits, func(code, symbol int, extra uint32, n uint) {
+		w.writeSymbol(best[code], symbol)
+		w.writeBits(extra, n)
+	})
+}
+
+// prefixCode is the canonical prefix code of the symbols of an alphabet
+type prefixCode struct {
+	lengths []uint8
+	// codes are the codes of the symbols with their bits reversed, as they
+	// are read from their most significant bit
+	codes []uint16
+	// symbols is the number of the symbols of the code, which takes no
+	// bits if it is 1
+	symbols int
+	first   int
+}
+
+// newPrefixCode returns the prefix code of the histogram of the symbols,
+// whose code lengths are at most maxLength
+func newPrefixCode(hist []uint32, maxLength int) *prefixCode {
+	c := &prefixCode{
+		lengths: huffmanLengths(hist, maxLength),
+		codes:   make([]uint16, len(hist)),
+	}
+
+	var count [16]int
+	for s, l := range c.lengths {
+		if l > 0 {
+			if c.symbols == 0 {
+				c.first = s
+			}
+			c.symbols++
+			count[l]++
+		}
+	}
+	var next [16]int
+	code := 0
+	for l := 1; l < len(next); l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range c.lengths {
+		if l > 0 {
+			c.codes[s] = reverseBits(uint16(next[l]), l)
+			next[l]++
+		}
+	}
+	return c
+}
+
+// size returns the number of the bits of the symbols of the histogram
+func (c *prefixCode) size(hist []uint32) int {
+	if c.symbols <= 1 {
+		return 0
+	}
+	n := 0
+	for s, count := range hist {
+		n += int(count) * int(c.lengths[s])
+	}
+	return n
+}
+
+// huffNode is a node of a Huffman tree, a leaf of the symbol unless it has
+// children
+type huffNode struct {
+	weight      uint64
+	symbol      int
+	left, right int
+}
+
+// huffmanLengths returns the code lengths of the Huffman code of the
+// histogram, limited to maxLength by raising the smallest counts until the
+// tree is shallow enough
+func huffmanLengths(hist []uint32, maxLength int) []uint8 {
+	lengths := make([]uint8, len(hist))
+	var symbols []int
+	for s, count := range hist {
+		if count > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+
+	for minWeight := uint64(1); ; minWeight *= 2 {
+		nodes := make([]huffNode, 0, 2*len(symbols)-1)
+		for _, s := range symbols {
+			weight := uint64(hist[s])
+			if weight < minWeight {
+				weight = minWeight
+			}
+			nodes = append(nodes, huffNode{weight: weight, symbol: s, left: -1, right: -1})
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+
+		// merge the two lightest of the leaves and the merged nodes, which
+		// are made in the order of their weights
+		leaves := len(nodes)
+		i, j := 0, leaves
+		lightest := func() int {
+			if i < leaves && (j == len(nodes) || nodes[i].weight <= nodes[j].weight) {
+				i++
+				return i - 1
+			}
+			j++
+			return j - 1
+		}
+		for k := 1; k < leaves; k++ {
+			a := lightest()
+			b := lightest()
+			nodes = append(nodes, huffNode{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+		}
+
+		// the parents come after their children
+		depth := make([]int, len(nodes))
+		deepest := 0
+		for k := len(nodes) - 1; k >= 0; k-- {
+			n := nodes[k]
+			if n.left < 0 {
+				lengths[n.symbol] = uint8(depth[k])
+				deepest = maxInt(deepest, depth[k])
+				continue
+			}
+			depth[n.left] = depth[k] + 1
+			depth[n.right] = depth[k] + 1
+		}
+		if deepest <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// reverseBits reverses the n lower bits of the code
+func reverseBits(code uint16, n uint8) uint16 {
+	return bits.Reverse16(code) >> (16 - n)
+}
+
+// writeSymbol writes the code of the symbol
+func (w *bitWriter) writeSymbol(c *prefixCode, symbol int) {
+	if c.symbols > 1 {
+		w.writeBits(uint32(c.codes[symbol]), uint(c.lengths[symbol]))
+	}
+}
+
+// writePrefixCode writes the code lengths of the prefix code, or the
+// simple code of its symbol if it has a single symbol of 8 bits
+func (w *bitWriter) writePrefixCode(c *prefixCode) {
+	switch {
+	case c.symbols == 0:
+		w.writeSimpleCode(0)
+		return
+	case c.symbols == 1 && c.first < vp8lLiterals:
+		w.writeSimpleCode(uint8(c.first))
+		return
+	}
+
+	// the code lengths are coded by the code of the code lengths, with
+	// the runs of zeros (17 and 18) and of the previous length (16)
+	type token struct {
+		symbol int
+		extra  uint32
+		n      uint
+	}
+	var tokens []token
+	for i := 0; i < len(c.lengths); {
+		l := c.lengths[i]
+		run := 1
+		for i+run < len(c.lengths) && c.lengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run > 0 {
+				switch {
+				case run < 3:
+					tokens = append(tokens, token{symbol: 0})
+					run--
+				case run <= 10:
+					tokens = append(tokens, token{symbol: 17, extra: uint32(run - 3), n: 3})
+					run = 0
+				default:
+					r := minInt(run, 138)
+					tokens = append(tokens, token{symbol: 18, extra: uint32(r - 11), n: 7})
+					run -= r
+				}
+			}
+			continue
+		}
+
+		tokens = append(tokens, token{symbol: int(l)})
+		for run--; run > 0; {
+			if run < 3 {
+				tokens = append(tokens, token{symbol: int(l)})
+				run--
+				continue
+			}
+			r := minInt(run, 6)
+			tokens = append(tokens, token{symbol: 16, extra: uint32(r - 3), n: 2})
+			run -= r
+		}
+	}
+
+	hist := make([]uint32, vp8lCodeLengths)
+	for _, t := range tokens {
+		hist[t.symbol]++
+	}
+	lengthCode := newPrefixCode(hist, 7)
+
+	w.writeBits(0, 1) // normal code
+	count := 4
+	for i, s := range codeLengthCodeOrder {
+		if lengthCode.lengths[s] > 0 {
+			count = maxInt(count, i+1)
+		}
+	}
+	w.writeBits(uint32(count-4), 4)
+	for _, s := range codeLengthCodeOrder[:count] {
+		w.writeBits(uint32(lengthCode.lengths[s]), 3)
+	}
+	w.writeBits(0, 1) // the lengths of all the symbols follow
+
+	for _, t := range tokens {
+		w.writeSymbol(lengthCode, t.symbol)
+		w.writeBits(t.extra, t.n)
+	}
+}
+
+// bitWriter writes the bits from the least significant one as VP8L
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+// writeBits writes the n lower bits of v
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nacc
+	w.nacc += n
+	for w.nacc >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+// len returns the number of the bits written
+func (w *bitWriter) len() int {
+	return 8*len(w.buf) + int(w.nacc)
+}
+
+// bytes returns the bits written, padded with zeros to the byte
+func (w *bitWriter) bytes() []byte {
+	if w.nacc > 0 {
+		return append(w.buf, byte(w.acc))
+	}
+	return w.buf
+}
+
+// writeSimpleCode writes the prefix code of the single symbol, which takes
+// no bits in the pixel data
+func (w *bitWriter) writeSimpleCode(symbol uint8) {
+	w.writeBits(1, 1) // simple code
+	w.writeBits(0, 1) // one symbol
+	w.writeBits(1, 1) // of 8 bits
+	w.writeBits(uint32(symbol), 8)
+}
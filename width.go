@@ -0,0 +1,203 @@
+package germanium
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// character width modes
+const (
+	// WidthGlyph lays out the characters with the advances of their glyphs
+	WidthGlyph = "glyph"
+	// WidthCell lays out the characters in the cells of a terminal, where the
+	// East Asian wide characters take two cells
+	WidthCell = "cell"
+)
+
+const (
+	zeroWidthJoiner = '\u200d'
+	tabWidth        = 4
+)
+
+// wideRanges are the East Asian Wide (W) and Fullwidth (F) characters
+var wideRanges = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x303e},
+	{0x3041, 0x33ff}, {0x3400, 0x4dbf}, {0x4e00, 0x9fff}, {0xa000, 0xa4cf},
+	{0xa960, 0xa97f}, {0xac00, 0xd7a3}, {0xf900, 0xfaff}, {0xfe10, 0xfe19},
+	{0xfe30, 0xfe6f}, {0xff00, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4},
+	{0x17000, 0x18aff}, {0x1b000, 0x1b2ff}, {0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf},
+	{0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a}, {0x1f200, 0x1f202}, {0x1f210, 0x1f23b},
+	{0x1f240, 0x1f248}, {0x1f250, 0x1f251}, {0x1f260, 0x1f265}, {0x1f300, 0x1f320},
+	{0x1f32d, 0x1f335}, {0x1f337, 0x1f37c}, {0x1f37e, 0x1f393}, {0x1f3a0, 0x1f3ca},
+	{0x1f3cf, 0x1f3d3}, {0x1f3e0, 0x1f3f0}, {0x1f3f4, 0x1f3f4}, {0x1f3f8, 0x1f43e},
+	{0x1f440, 0x1f440}, {0x1f442, 0x1f4fc}, {0x1f4ff, 0x1f53d}, {0x1f54b, 0x1f54e},
+	{0x1f550, 0x1f567}, {0x1f57a, 0x1f57a}, {0x1f595, 0x1f596}, {0x1f5a4, 0x1f5a4},
+	{0x1f5fb, 0x1f64f}, {0x1f680, 0x1f6c5}, {0x1f6cc, 0x1f6cc}, {0x1f6d0, 0x1f6d2},
+	{0x1f6d5, 0x1f6d7}, {0x1f6eb, 0x1f6ec}, {0x1f6f4, 0x1f6fc}, {0x1f7e0, 0x1f7eb},
+	{0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945}, {0x1f947, 0x1f9ff}, {0x1fa70, 0x1faff},
+	{0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
+
+// isWide reports whether the rune is an East Asian wide character
+func isWide(r rune) bool {
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i][1] >= r })
+	return i < len(wideRanges) && wideRanges[i][0] <= r
+}
+
+// isExtender reports whether the rune extends the preceding character
+// without taking a width, such as combining marks, variation selectors and
+// emoji modifiers
+func isExtender(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || (0x1f3fb <= r && r <= 0x1f3ff)
+}
+
+// cluster is a grapheme cluster laid out on a line
+type cluster struct {
+	// base is the drawn character, 0 if the cluster only has marks
+	base rune
+	// marks are the combining marks drawn over the base
+	marks []rune
+	// x is the offset from the start of the text
+	x     fixed.Int26_6
+	width fixed.Int26_6
+}
+
+// segment splits the text into grapheme clusters. A character joined by a
+// zero width joiner is folded into the preceding cluster: freetype cannot
+// compose an emoji ZWJ sequence, so it is drawn as its first emoji.
+func segment(text string) []cluster {
+	var clusters []cluster
+	joining := false
+	for _, r := range text {
+		if r == '\n' {
+			continue
+		}
+		last := len(clusters) - 1
+		switch {
+		case joining && last >= 0:
+			joining = false
+		case r == zeroWidthJoiner && last >= 0:
+			joining = true
+		case isExtender(r) && last >= 0:
+			clusters[last].marks = append(clusters[last].marks, r)
+		case isExtender(r):
+			clusters = append(clusters, cluster{marks: []rune{r}})
+		default:
+			clusters = append(clusters, cluster{base: r})
+		}
+	}
+	return clusters
+}
+
+// advance returns how far the formatter moves the dot after drawing the rune
+func advance(face font.Face, r rune) fixed.Int26_6 {
+	if r == '\t' {
+		return font.MeasureString(face, "    ")
+	}
+	a, _ := face.GlyphAdvance(r)
+	return a + fixed.Int26_6(a.Round())
+}
+
+// cells returns the number of terminal cells the character takes
+func cells(r rune) int {
+	switch {
+	case r == 0:
+		return 0
+	case r == '\t':
+		return tabWidth
+	case isWide(r):
+		return 2
+	}
+	return 1
+}
+
+// layoutText lays out the grapheme clusters of the text and returns them
+// with the width of the text. This is shared by the measurement of the
+// canvas and the formatters, so that the text always fits in the window.
+func layoutText(face font.Face, text string, mode string) ([]cluster, fixed.Int26_6) {
+	clusters := segment(text)
+	cell := advance(face, ' ')
+
+	var x fixed.Int26_6
+	for i := range clusters {
+		c := &clusters[i]
+		c.x = x
+		switch {
+		case mode == WidthCell:
+			c.width = cell * fixed.Int26_6(cells(c.base))
+		case c.base != 0:
+			c.width = advance(face, c.base)
+		}
+		x += c.width
+	}
+	return clusters, x
+}
+
+// textWidth returns the width of the text drawn by the formatter
+func textWidth(face font.Face, text string, mode string) fixed.Int26_6 {
+	_, width := layoutText(face, text, mode)
+	return width
+}
+
+// hasGlyph reports whether the face has the glyph of the rune rather than
+// the glyph for missing characters
+func hasGlyph(face font.Face, r rune) bool {
+	bounds, adv, _ := face.GlyphBounds(r)
+	missing, missingAdv, _ := face.GlyphBounds(0xffff)
+	return bounds != missing || adv != missingAdv
+}
+
+// drawCluster draws the cluster on the line starting at x. In the cell mode
+// the glyph is centered in its cells.
+func drawCluster(d *font.Drawer, c cluster, x, y fixed.Int26_6, mode string) {
+	if c.base == '\t' {
+		return
+	}
+
+	var a fixed.Int26_6
+	if c.base != 0 {
+		a, _ = d.Face.GlyphAdvance(c.base)
+		x += fixed.Int26_6(a.Round())
+		if mode == WidthCell {
+			x += (c.width - advance(d.Face, c.base)) / 2
+		}
+		d.Dot = fixed.Point26_6{X: x, Y: y}
+		d.DrawString(string(c.base))
+	}
+
+	// the marks are positioned from the end of the base like a zero width
+	// glyph, and the ones missing in the font are not drawn
+	for _, m := range c.marks {
+		if !hasGlyph(d.Face, m) {
+			continue
+		}
+		ma, _ := d.Face.GlyphAdvance(m)
+		d.Dot = fixed.Point26_6{X: x + a - ma, Y: y}
+		d.DrawString(string(m))
+	}
+}
+
+// SetWidthMode sets how the width of the characters is measured, WidthGlyph
+// or WidthCell
+func (p *Panel) SetWidthMode(mode string) error {
+	switch mode {
+	case WidthGlyph, WidthCell:
+	default:
+		return fmt.Errorf("unsupported width mode: %s", mode)
+	}
+
+	p.widthMode = mode
+	return nil
+}
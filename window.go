@@ -0,0 +1,284 @@
+package germanium
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// ButtonShape is the shape of a window control button
+type ButtonShape int
+
+// button shapes
+const (
+	ButtonCircle ButtonShape = iota
+	ButtonSquare
+)
+
+// ButtonGlyph is the symbol drawn on a window control button
+type ButtonGlyph int
+
+// button glyphs
+const (
+	GlyphNone ButtonGlyph = iota
+	GlyphClose
+	GlyphMinimize
+	GlyphMaximize
+)
+
+// WindowButton is a control button in the access bar
+type WindowButton struct {
+	Shape ButtonShape
+	Glyph ButtonGlyph
+	// X is the center of the button from the left edge of the bar, or from
+	// the right edge if negative
+	X int
+	// Size is the radius of a circle or the half of the side of a square
+	Size int
+	// Color fills the button, which is not filled if nil
+	Color color.Color
+}
+
+// WindowStyle defines the look and the metrics of the window chrome
+type WindowStyle struct {
+	Name string
+	// BarHeight is the height of the access bar from the top edge of the
+	// window, 0 for no bar
+	BarHeight int
+	// BarColor is laid over the window background in the bar
+	BarColor color.Color
+	Buttons  []WindowButton
+}
+
+// window styles
+var (
+	WindowStyleMacOS = WindowStyle{
+		Name:      "macos",
+		BarHeight: 60,
+		Buttons: []WindowButton{
+			{Shape: ButtonCircle, X: 30, Size: radius, Color: close},
+			{Shape: ButtonCircle, X: 60, Size: radius, Color: minimum},
+			{Shape: ButtonCircle, X: 90, Size: radius, Color: maximum},
+		},
+	}
+	WindowStyleWindows = WindowStyle{
+		Name:      "windows",
+		BarHeight: 50,
+		BarColor:  color.NRGBA{0, 0, 0, 0x28},
+		Buttons: []WindowButton{
+			{Shape: ButtonSquare, Glyph: GlyphMinimize, X: -115, Size: 10},
+			{Shape: ButtonSquare, Glyph: GlyphMaximize, X: -69, Size: 10},
+			{Shape: ButtonSquare, Glyph: GlyphClose, X: -23, Size: 10},
+		},
+	}
+	WindowStyleGNOME = WindowStyle{
+		Name:      "gnome",
+		BarHeight: 56,
+		BarColor:  color.NRGBA{0, 0, 0, 0x18},
+		Buttons: []WindowButton{
+			{Shape: ButtonCircle, Glyph: GlyphMinimize, X: -94, Size: 12, Color: color.NRGBA{0x80, 0x80, 0x80, 0x50}},
+			{Shape: ButtonCircle, Glyph: GlyphMaximize, X: -62, Size: 12, Color: color.NRGBA{0x80, 0x80, 0x80, 0x50}},
+			{Shape: ButtonCircle, Glyph: GlyphClose, X: -30, Size: 12, Color: color.NRGBA{0x80, 0x80, 0x80, 0x50}},
+		},
+	}
+	WindowStyleMinimal = WindowStyle{
+		Name:      "minimal",
+		BarHeight: 40,
+	}
+	WindowStyleNone = WindowStyle{
+		Name: "none",
+	}
+)
+
+var windowStyles = []WindowStyle{
+	WindowStyleMacOS,
+	WindowStyleWindows,
+	WindowStyleGNOME,
+	WindowStyleMinimal,
+	WindowStyleNone,
+}
+
+// WindowStyleNames returns the names of the window styles
+func WindowStyleNames() []string {
+	names := make([]string, len(windowStyles))
+	for i, s := range windowStyles {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// GetWindowStyle returns the window style of the name
+func GetWindowStyle(name string) (WindowStyle, error) {
+	for _, s := range windowStyles {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return WindowStyle{}, fmt.Errorf("unknown window style: %s (available: %s)", name, strings.Join(WindowStyleNames(), ", "))
+}
+
+// SetWindowStyle sets the window chrome
+func (p *Panel) SetWindowStyle(s WindowStyle) {
+	p.windowStyle = s
+}
+
+// bar returns the rectangle of the access bar of the window with the
+// corners of the radius r
+func (s WindowStyle) bar(window image.Rectangle, r int) image.Rectangle {
+	outer := window.Inset(-r)
+	return image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, outer.Min.Y+s.BarHeight)
+}
+
+// center returns the center of the button in the bar
+func (b WindowButton) center(bar image.Rectangle) image.Point {
+	x := bar.Min.X + b.X
+	if b.X < 0 {
+		x = bar.Max.X + b.X
+	}
+	return image.Point{X: x, Y: bar.Min.Y + bar.Dy()/2}
+}
+
+// buttonsMargin returns the room taken by the buttons from the edges of the
+// bar, which the title does not overlap, with the corners of the radius r
+func (s WindowStyle) buttonsMargin(r int) int {
+	margin := 0
+	for _, b := range s.Buttons {
+		extent := b.X + b.Size
+		if b.X < 0 {
+			extent = -b.X + b.Size
+		}
+		if margin < extent {
+			margin = extent
+		}
+	}
+	return margin + r
+}
+
+// drawWindowBar draws the access bar and its control buttons
+func (p *Panel) drawWindowBar() {
+	s := p.px.window
+	if s.BarHeight == 0 {
+		return
+	}
+	r := p.px.radius
+	bar := s.bar(p.window, r)
+
+	if s.BarColor != nil {
+		mask := image.NewAlpha(bar)
+		fillRoundedRect(mask, p.window.Inset(-r), p.px.corner)
+		draw.DrawMask(p.img, bar, image.NewUniform(s.BarColor), image.Point{}, mask, bar.Min, draw.Over)
+	}
+
+	buttons := NewPanel(bar.Min.X, bar.Min.Y, bar.Max.X, bar.Max.Y)
+	glyphColor := color.RGBAModel.Convert(chooseColorBasedOnContrast(p.windowColor)).(color.RGBA)
+	for _, b := range s.Buttons {
+		center := b.center(bar)
+		if b.Color != nil {
+			c := color.RGBAModel.Convert(b.Color).(color.RGBA)
+			switch b.Shape {
+			case ButtonCircle:
+				fillShape(buttons.img, circle(center, b.Size), c, bar)
+			case ButtonSquare:
+				draw.Draw(buttons.img, image.Rectangle{center, center}.Inset(-b.Size), image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+		buttons.drawGlyph(b.Glyph, center, b.Size/2, p.px.stroke, glyphColor)
+	}
+	draw.Draw(p.img, bar, buttons.img, bar.Min, draw.Over)
+}
+
+// drawGlyph draws the glyph of the button anti-aliased in the strokes of
+// the width, in the square of the half side g around the center
+func (p *Panel) drawGlyph(glyph ButtonGlyph, center image.Point, g int, width float64, c color.RGBA) {
+	if glyph == GlyphNone {
+		return
+	}
+	fillShape(p.img, glyphShape(glyph, center, g, width), c, p.img.Bounds())
+}
+
+// glyphShape returns the shape of the strokes of the glyph, which run
+// through the centers of the pixels if their width is odd, and between the
+// pixels if even, so that the straight strokes are sharp
+func glyphShape(glyph ButtonGlyph, center image.Point, g int, width float64) shape {
+	off := float32(math.Mod(math.Round(width), 2)) / 2
+	cx, cy := float32(center.X)+off, float32(center.Y)+off
+	gf, w := float32(g), float32(width)
+	return func(z *vector.Rasterizer, origin image.Point) {
+		ox, oy := float32(origin.X), float32(origin.Y)
+		switch glyph {
+		case GlyphClose:
+			addLine(z, cx-gf-ox, cy-gf-oy, cx+gf-ox, cy+gf-oy, w)
+			addLine(z, cx-gf-ox, cy+gf-oy, cx+gf-ox, cy-gf-oy, w)
+		case GlyphMinimize:
+			addLine(z, cx-gf-ox, cy-oy, cx+gf-ox, cy-oy, w)
+		case GlyphMaximize:
+			// the inner square runs the other way round to be a hole
+			outer, inner := gf+w/2, gf-w/2
+			z.MoveTo(cx-outer-ox, cy-outer-oy)
+			z.LineTo(cx+outer-ox, cy-outer-oy)
+			z.LineTo(cx+outer-ox, cy+outer-oy)
+			z.LineTo(cx-outer-ox, cy+outer-oy)
+			z.ClosePath()
+			if inner > 0 {
+				z.MoveTo(cx-inner-ox, cy-inner-oy)
+				z.LineTo(cx-inner-ox, cy+inner-oy)
+				z.LineTo(cx+inner-ox, cy+inner-oy)
+				z.LineTo(cx+inner-ox, cy-inner-oy)
+				z.ClosePath()
+			}
+		}
+	}
+}
+
+// svgWindowBar returns the SVG markup of the access bar and its control
+// buttons
+func (p *Panel) svgWindowBar() string {
+	s := p.px.window
+	if s.BarHeight == 0 {
+		return ""
+	}
+	bar := s.bar(p.window, p.px.radius)
+	r := p.px.corner
+
+	var b strings.Builder
+	if s.BarColor != nil {
+		// the top corners are rounded like the window
+		fmt.Fprintf(&b, `<path d="M%d,%d V%d A%d,%d 0 0 1 %d,%d H%d A%d,%d 0 0 1 %d,%d V%d Z" fill="%s"/>`+"\n",
+			bar.Min.X, bar.Max.Y, bar.Min.Y+r, r, r, bar.Min.X+r, bar.Min.Y,
+			bar.Max.X-r, r, r, bar.Max.X, bar.Min.Y+r, bar.Max.Y, svgColor(s.BarColor))
+	}
+
+	glyphColor := svgColor(chooseColorBasedOnContrast(p.windowColor))
+	for _, btn := range s.Buttons {
+		c := btn.center(bar)
+		if btn.Color != nil {
+			switch btn.Shape {
+			case ButtonCircle:
+				fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s"/>`+"\n", c.X, c.Y, btn.Size, svgColor(btn.Color))
+			case ButtonSquare:
+				fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", c.X-btn.Size, c.Y-btn.Size, btn.Size*2, btn.Size*2, svgColor(btn.Color))
+			}
+		}
+
+		g := btn.Size / 2
+		var d string
+		switch btn.Glyph {
+		case GlyphClose:
+			d = fmt.Sprintf("M%d,%d L%d,%d M%d,%d L%d,%d", c.X-g, c.Y-g, c.X+g, c.Y+g, c.X-g, c.Y+g, c.X+g, c.Y-g)
+		case GlyphMinimize:
+			d = fmt.Sprintf("M%d,%d H%d", c.X-g, c.Y, c.X+g)
+		case GlyphMaximize:
+			d = fmt.Sprintf("M%d,%d H%d V%d H%d Z", c.X-g, c.Y-g, c.X+g, c.Y+g, c.X-g)
+		}
+		if d != "" {
+			fmt.Fprintf(&b, `<path d="%s" stroke="%s" stroke-width="%g" stroke-linecap="square" fill="none"/>`+"\n", d, glyphColor, p.px.stroke)
+		}
+	}
+
+	return b.String()
+}